@@ -4,10 +4,16 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/phillip-england/engl/pkg/filescanner"
+	"github.com/phillip-england/engl/pkg/gosource"
+	"github.com/phillip-england/engl/pkg/history"
 	"github.com/phillip-england/engl/pkg/pathutil"
 	"github.com/phillip-england/engl/pkg/shell"
+	"github.com/phillip-england/engl/pkg/trash"
 )
 
 type Endpoint struct {
@@ -26,11 +32,30 @@ type IndexResponse struct {
 var endpoints = []Endpoint{
 	{Path: "/", Method: "GET", Description: "This index - lists all available endpoints"},
 	{Path: "/mcp/tool/file_scanner/list", Method: "POST", Description: "List directory contents as a tree structure"},
-	{Path: "/mcp/tool/file_scanner/read", Method: "POST", Description: "Read file contents"},
+	{Path: "/mcp/tool/file_scanner/read", Method: "POST", Description: "Read file contents, or a byte range of them"},
 	{Path: "/mcp/tool/file_scanner/write", Method: "POST", Description: "Write content to a file"},
 	{Path: "/mcp/tool/file_scanner/delete", Method: "POST", Description: "Delete a file or directory"},
+	{Path: "/mcp/tool/file_scanner/move", Method: "POST", Description: "Move or rename a file or directory"},
+	{Path: "/mcp/tool/file_scanner/copy", Method: "POST", Description: "Copy a file or directory"},
+	{Path: "/mcp/tool/file_scanner/edit", Method: "POST", Description: "Replace an exact string in a file"},
+	{Path: "/mcp/tool/file_scanner/edit_lines", Method: "POST", Description: "Insert, replace or delete a range of lines in a file"},
+	{Path: "/mcp/tool/file_scanner/patch", Method: "POST", Description: "Apply a multi-file unified diff"},
+	{Path: "/mcp/tool/file_scanner/transaction", Method: "POST", Description: "Apply write, edit, move and delete operations all or nothing"},
+	{Path: "/mcp/tool/file_scanner/search", Method: "POST", Description: "Search file contents by regex or literal"},
+	{Path: "/mcp/tool/file_scanner/find", Method: "POST", Description: "Fuzzy find files by path"},
+	{Path: "/mcp/tool/file_scanner/stats", Method: "POST", Description: "Report file, byte and line counts by language"},
+	{Path: "/mcp/tool/file_scanner/diff", Method: "POST", Description: "Unified diff between two files or a file and proposed content"},
+	{Path: "/mcp/tool/history/list", Method: "POST", Description: "List the saved versions of a file"},
+	{Path: "/mcp/tool/history/read", Method: "POST", Description: "Read a saved version of a file"},
+	{Path: "/mcp/tool/history/restore", Method: "POST", Description: "Restore a file to a saved version"},
+	{Path: "/mcp/tool/trash/list", Method: "GET", Description: "List deleted files held in the trash"},
+	{Path: "/mcp/tool/trash/restore", Method: "POST", Description: "Restore a deleted file from the trash"},
+	{Path: "/mcp/tool/trash/purge", Method: "POST", Description: "Permanently remove items from the trash"},
+	{Path: "/mcp/tool/go_source/outline", Method: "POST", Description: "Outline the declarations of a Go file or package"},
 	{Path: "/mcp/tool/shell/list", Method: "GET", Description: "List available shell commands"},
 	{Path: "/mcp/tool/shell/exec", Method: "POST", Description: "Execute a whitelisted shell command"},
+	{Path: "/mcp/tool/shell/exec_stream", Method: "POST", Description: "Execute a whitelisted shell command, streaming its output as server-sent events"},
+	{Path: "/mcp/tool/shell/reload", Method: "POST", Description: "Reload the shell command allowlist from its config file"},
 }
 
 func indexHandler(w http.ResponseWriter, r *http.Request) {
@@ -63,14 +88,53 @@ func cors(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// reloadOnHangup reloads the shell config each time the process gets SIGHUP
+func reloadOnHangup() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := shell.Reload(); err != nil {
+			log.Printf("shell config reload failed: %v", err)
+			continue
+		}
+		log.Printf("shell config reloaded")
+	}
+}
+
 func main() {
+	// The shell allowlist comes from ENGL_SHELL_CONFIG when set. A bad file
+	// stops startup; SIGHUP reloads it.
+	if err := shell.LoadConfig(os.Getenv("ENGL_SHELL_CONFIG")); err != nil {
+		log.Fatal(err)
+	}
+	go reloadOnHangup()
+
 	http.HandleFunc("/", cors(indexHandler))
 	http.HandleFunc("/mcp/tool/file_scanner/list", cors(filescanner.ListHandler))
 	http.HandleFunc("/mcp/tool/file_scanner/read", cors(filescanner.ReadHandler))
 	http.HandleFunc("/mcp/tool/file_scanner/write", cors(filescanner.WriteHandler))
 	http.HandleFunc("/mcp/tool/file_scanner/delete", cors(filescanner.DeleteHandler))
+	http.HandleFunc("/mcp/tool/file_scanner/move", cors(filescanner.MoveHandler))
+	http.HandleFunc("/mcp/tool/file_scanner/copy", cors(filescanner.CopyHandler))
+	http.HandleFunc("/mcp/tool/file_scanner/edit", cors(filescanner.EditHandler))
+	http.HandleFunc("/mcp/tool/file_scanner/edit_lines", cors(filescanner.EditLinesHandler))
+	http.HandleFunc("/mcp/tool/file_scanner/patch", cors(filescanner.PatchHandler))
+	http.HandleFunc("/mcp/tool/file_scanner/transaction", cors(filescanner.TransactionHandler))
+	http.HandleFunc("/mcp/tool/file_scanner/search", cors(filescanner.SearchHandler))
+	http.HandleFunc("/mcp/tool/file_scanner/find", cors(filescanner.FindHandler))
+	http.HandleFunc("/mcp/tool/file_scanner/stats", cors(filescanner.StatsHandler))
+	http.HandleFunc("/mcp/tool/file_scanner/diff", cors(filescanner.DiffHandler))
+	http.HandleFunc("/mcp/tool/history/list", cors(history.ListHandler))
+	http.HandleFunc("/mcp/tool/history/read", cors(history.ReadHandler))
+	http.HandleFunc("/mcp/tool/history/restore", cors(history.RestoreHandler))
+	http.HandleFunc("/mcp/tool/trash/list", cors(trash.ListHandler))
+	http.HandleFunc("/mcp/tool/trash/restore", cors(trash.RestoreHandler))
+	http.HandleFunc("/mcp/tool/trash/purge", cors(trash.PurgeHandler))
+	http.HandleFunc("/mcp/tool/go_source/outline", cors(gosource.OutlineHandler))
 	http.HandleFunc("/mcp/tool/shell/list", cors(shell.ListHandler))
 	http.HandleFunc("/mcp/tool/shell/exec", cors(shell.ExecHandler))
+	http.HandleFunc("/mcp/tool/shell/exec_stream", cors(shell.StreamHandler))
+	http.HandleFunc("/mcp/tool/shell/reload", cors(shell.ReloadHandler))
 
 	port := ":8080"
 	log.Printf("MCP Server listening on %s...", port)
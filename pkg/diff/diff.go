@@ -0,0 +1,327 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// DefaultContext is the number of context lines used by most diff tools
+const DefaultContext = 3
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind opKind
+	text string
+}
+
+// SplitLines splits s into lines, keeping each line's trailing newline so the
+// lines can be joined back into s exactly
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Unified returns a unified diff turning from into to, with the given number
+// of context lines around each change. It returns "" when they are identical.
+func Unified(fromName, toName, from, to string, context int) string {
+	ops := compute(SplitLines(from), SplitLines(to))
+	return render(fromName, toName, ops, context, writeLineHunk)
+}
+
+// WordUnified is like Unified but shows changed lines as a single run of text
+// with removed words wrapped in [-...-] and added words in {+...+}, in the
+// style of git's --word-diff=plain. Lines carry no +/-/space prefix.
+func WordUnified(fromName, toName, from, to string, context int) string {
+	ops := compute(SplitLines(from), SplitLines(to))
+	return render(fromName, toName, ops, context, writeWordHunk)
+}
+
+// Words returns the word-level diff of from and to using the same markers as
+// WordUnified
+func Words(from, to string) string {
+	var b, del, ins strings.Builder
+	flush := func() {
+		if del.Len() > 0 {
+			b.WriteString("[-" + del.String() + "-]")
+			del.Reset()
+		}
+		if ins.Len() > 0 {
+			b.WriteString("{+" + ins.String() + "+}")
+			ins.Reset()
+		}
+	}
+
+	for _, o := range compute(tokenize(from), tokenize(to)) {
+		switch o.kind {
+		case opEqual:
+			flush()
+			b.WriteString(o.text)
+		case opDelete:
+			del.WriteString(o.text)
+		case opInsert:
+			ins.WriteString(o.text)
+		}
+	}
+	flush()
+	return b.String()
+}
+
+func tokenize(s string) []string {
+	var tokens []string
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		j := i + 1
+		switch {
+		case isWordRune(runes[i]):
+			for j < len(runes) && isWordRune(runes[j]) {
+				j++
+			}
+		case unicode.IsSpace(runes[i]):
+			for j < len(runes) && unicode.IsSpace(runes[j]) && runes[j-1] != '\n' {
+				j++
+			}
+		}
+		tokens = append(tokens, string(runes[i:j]))
+		i = j
+	}
+	return tokens
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// compute returns the shortest edit script turning a into b
+func compute(a, b []string) []op {
+	// Trim the common prefix and suffix; they are cheap and usually large
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]op, 0, len(a)+len(b))
+	for _, s := range a[:prefix] {
+		ops = append(ops, op{opEqual, s})
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, s := range a[len(a)-suffix:] {
+		ops = append(ops, op{opEqual, s})
+	}
+	return ops
+}
+
+// myers implements Myers' O((N+M)D) diff. For each edit distance d it keeps
+// only the diagonals -d-1..d+1 of the frontier, so backtracking costs O(D²)
+// memory rather than O((N+M)·D).
+func myers(a, b []string) []op {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+
+	found := false
+	for d := 0; d <= n+m && !found; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	var rev []op
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		snap := trace[d]
+		at := func(k int) int { return snap[k+d+1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			rev = append(rev, op{opEqual, a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				rev = append(rev, op{opInsert, b[y-1]})
+			} else {
+				rev = append(rev, op{opDelete, a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	ops := make([]op, len(rev))
+	for i, o := range rev {
+		ops[len(rev)-1-i] = o
+	}
+	return ops
+}
+
+type hunkWriter func(b *strings.Builder, ops []op)
+
+// render groups ops into hunks with context lines and writes them with the
+// standard ---/+++ file header and @@ range headers
+func render(fromName, toName string, ops []op, context int, write hunkWriter) string {
+	if context < 0 {
+		context = 0
+	}
+
+	// aPos[i] and bPos[i] count the lines of each side consumed before ops[i]
+	aPos := make([]int, len(ops)+1)
+	bPos := make([]int, len(ops)+1)
+	changed := false
+	for i, o := range ops {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if o.kind != opInsert {
+			aPos[i+1]++
+		}
+		if o.kind != opDelete {
+			bPos[i+1]++
+		}
+		if o.kind != opEqual {
+			changed = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", fromName, toName)
+
+	i := 0
+	for i < len(ops) {
+		for i < len(ops) && ops[i].kind == opEqual {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		start := max(i-context, 0)
+		end := i
+		for {
+			for end < len(ops) && ops[end].kind != opEqual {
+				end++
+			}
+			run := 0
+			for end+run < len(ops) && ops[end+run].kind == opEqual {
+				run++
+			}
+			if end+run < len(ops) && run <= 2*context {
+				end += run
+				continue
+			}
+			end += min(run, context)
+			break
+		}
+
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n",
+			hunkRange(aPos[start], aPos[end]-aPos[start]),
+			hunkRange(bPos[start], bPos[end]-bPos[start]))
+		write(&b, ops[start:end])
+		i = end
+	}
+
+	return b.String()
+}
+
+// hunkRange formats a 0-based start and a length the way GNU diff does
+func hunkRange(start, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+func writeLineHunk(b *strings.Builder, ops []op) {
+	for _, o := range ops {
+		switch o.kind {
+		case opEqual:
+			writeLine(b, " ", o.text)
+		case opDelete:
+			writeLine(b, "-", o.text)
+		case opInsert:
+			writeLine(b, "+", o.text)
+		}
+	}
+}
+
+func writeWordHunk(b *strings.Builder, ops []op) {
+	for i := 0; i < len(ops); {
+		if ops[i].kind == opEqual {
+			writeLine(b, "", ops[i].text)
+			i++
+			continue
+		}
+
+		var from, to strings.Builder
+		for i < len(ops) && ops[i].kind != opEqual {
+			if ops[i].kind == opDelete {
+				from.WriteString(ops[i].text)
+			} else {
+				to.WriteString(ops[i].text)
+			}
+			i++
+		}
+		writeLine(b, "", Words(from.String(), to.String()))
+	}
+}
+
+func writeLine(b *strings.Builder, prefix, line string) {
+	b.WriteString(prefix)
+	b.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		b.WriteString("\n\\ No newline at end of file\n")
+	}
+}
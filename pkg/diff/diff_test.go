@@ -0,0 +1,109 @@
+package diff
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		context int
+		want    string
+	}{
+		{
+			name: "identical",
+			from: "a\nb\n",
+			to:   "a\nb\n",
+			want: "",
+		},
+		{
+			name:    "single change",
+			from:    "a\nb\nc\nd\ne\n",
+			to:      "a\nb\nC\nd\ne\n",
+			context: 1,
+			want: "--- a.txt\n+++ b.txt\n" +
+				"@@ -2,3 +2,3 @@\n b\n-c\n+C\n d\n",
+		},
+		{
+			name:    "separate hunks",
+			from:    "1\n2\n3\n4\n5\n6\n7\n8\n",
+			to:      "x\n2\n3\n4\n5\n6\n7\ny\n",
+			context: 1,
+			want: "--- a.txt\n+++ b.txt\n" +
+				"@@ -1,2 +1,2 @@\n-1\n+x\n 2\n" +
+				"@@ -7,2 +7,2 @@\n 7\n-8\n+y\n",
+		},
+		{
+			name:    "nearby changes merge",
+			from:    "1\n2\n3\n4\n5\n",
+			to:      "x\n2\n3\n4\ny\n",
+			context: 2,
+			want: "--- a.txt\n+++ b.txt\n" +
+				"@@ -1,5 +1,5 @@\n-1\n+x\n 2\n 3\n 4\n-5\n+y\n",
+		},
+		{
+			name:    "insert into empty",
+			from:    "",
+			to:      "new\n",
+			context: 3,
+			want:    "--- a.txt\n+++ b.txt\n@@ -0,0 +1 @@\n+new\n",
+		},
+		{
+			name:    "missing newline at end",
+			from:    "a\nb",
+			to:      "a\nb\n",
+			context: 3,
+			want: "--- a.txt\n+++ b.txt\n" +
+				"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unified("a.txt", "b.txt", tt.from, tt.to, tt.context)
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWordUnified(t *testing.T) {
+	got := WordUnified("a", "b", "keep\nthe quick fox\n", "keep\nthe slow fox\n", 1)
+	want := "--- a\n+++ b\n@@ -1,2 +1,2 @@\nkeep\nthe [-quick-]{+slow+} fox\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestComputeReconstructs(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	alphabet := []string{"a\n", "b\n", "c\n", "d\n"}
+	randLines := func() []string {
+		lines := make([]string, rng.Intn(30))
+		for i := range lines {
+			lines[i] = alphabet[rng.Intn(len(alphabet))]
+		}
+		return lines
+	}
+
+	for i := 0; i < 200; i++ {
+		a, b := randLines(), randLines()
+		var gotA, gotB strings.Builder
+		for _, o := range compute(a, b) {
+			if o.kind != opInsert {
+				gotA.WriteString(o.text)
+			}
+			if o.kind != opDelete {
+				gotB.WriteString(o.text)
+			}
+		}
+		if gotA.String() != strings.Join(a, "") || gotB.String() != strings.Join(b, "") {
+			t.Fatalf("edit script does not reconstruct inputs for %q -> %q", a, b)
+		}
+	}
+}
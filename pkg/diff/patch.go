@@ -0,0 +1,357 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNoPatch          = errors.New("no file patches found")
+	ErrNotEmptyOnDelete = errors.New("file is not empty after applying deletion patch")
+)
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// FilePatch is the set of hunks a unified diff applies to one file. OldName
+// is empty for created files and NewName is empty for deleted files.
+type FilePatch struct {
+	OldName string
+	NewName string
+	Hunks   []Hunk
+}
+
+// IsCreate reports whether the patch creates a new file
+func (fp FilePatch) IsCreate() bool { return fp.OldName == "" }
+
+// IsDelete reports whether the patch deletes a file
+func (fp FilePatch) IsDelete() bool { return fp.NewName == "" }
+
+// IsRename reports whether the patch moves a file to a new name
+func (fp FilePatch) IsRename() bool {
+	return fp.OldName != "" && fp.NewName != "" && fp.OldName != fp.NewName
+}
+
+// Hunk is a single @@ section. Each line keeps its ' ', '-' or '+' prefix as
+// Kind and its text including the trailing newline, if any.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []HunkLine
+}
+
+type HunkLine struct {
+	Kind byte
+	Text string
+}
+
+// HunkResult reports how a hunk applied. Offset is how many lines away from
+// its stated position the hunk matched and Fuzz how many context lines had to
+// be ignored at each end.
+type HunkResult struct {
+	Hunk    int    `json:"hunk"`
+	Applied bool   `json:"applied"`
+	Offset  int    `json:"offset,omitempty"`
+	Fuzz    int    `json:"fuzz,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Parse reads a multi-file unified diff, as produced by diff -u or git diff.
+// Text outside file headers and hunks, such as commit messages, is ignored.
+func Parse(patch string) ([]FilePatch, error) {
+	// A patch cut off without its final newline still means one; only a
+	// "\ No newline at end of file" marker drops it
+	if patch != "" && !strings.HasSuffix(patch, "\n") {
+		patch += "\n"
+	}
+	lines := strings.SplitAfter(patch, "\n")
+
+	var patches []FilePatch
+	var cur *FilePatch
+	// gitHeader is set between a "diff --git" line and the file's first hunk,
+	// where --- and +++ lines belong to the current patch rather than start one
+	gitHeader := false
+
+	flush := func() {
+		if cur != nil {
+			patches = append(patches, *cur)
+			cur = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			cur = &FilePatch{}
+			gitHeader = true
+			if fields := strings.Fields(line); len(fields) == 4 {
+				cur.OldName = stripPrefix(fields[2])
+				cur.NewName = stripPrefix(fields[3])
+			}
+
+		case gitHeader && strings.HasPrefix(line, "new file mode"):
+			cur.OldName = ""
+
+		case gitHeader && strings.HasPrefix(line, "deleted file mode"):
+			cur.NewName = ""
+
+		case gitHeader && strings.HasPrefix(line, "rename from "):
+			cur.OldName = strings.TrimPrefix(line, "rename from ")
+
+		case gitHeader && strings.HasPrefix(line, "rename to "):
+			cur.NewName = strings.TrimPrefix(line, "rename to ")
+
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			if !gitHeader {
+				flush()
+				cur = &FilePatch{}
+			}
+			cur.OldName = headerName(line[4:])
+			cur.NewName = headerName(strings.TrimRight(lines[i+1], "\r\n")[4:])
+			i++
+
+		case strings.HasPrefix(line, "@@ "):
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: hunk without file header", i+1)
+			}
+			gitHeader = false
+			hunk, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			cur.Hunks = append(cur.Hunks, hunk)
+			i = next - 1
+		}
+	}
+	flush()
+
+	if len(patches) == 0 {
+		return nil, ErrNoPatch
+	}
+	return patches, nil
+}
+
+// parseHunk parses the hunk whose header is lines[start], returning it and
+// the index of the first line after it
+func parseHunk(lines []string, start int) (Hunk, int, error) {
+	header := strings.TrimRight(lines[start], "\r\n")
+	m := hunkHeader.FindStringSubmatch(header)
+	if m == nil {
+		return Hunk{}, 0, fmt.Errorf("line %d: malformed hunk header %q", start+1, header)
+	}
+
+	h := Hunk{
+		OldStart: atoi(m[1]),
+		OldLines: 1,
+		NewStart: atoi(m[3]),
+		NewLines: 1,
+	}
+	if m[2] != "" {
+		h.OldLines = atoi(m[2])
+	}
+	if m[4] != "" {
+		h.NewLines = atoi(m[4])
+	}
+
+	oldLeft, newLeft := h.OldLines, h.NewLines
+	i := start + 1
+	for ; i < len(lines) && (oldLeft > 0 || newLeft > 0); i++ {
+		text := lines[i]
+		if text == "" {
+			break
+		}
+
+		kind := text[0]
+		body := text[1:]
+		if text == "\n" || text == "\r\n" {
+			// Some tools strip the space from empty context lines
+			kind, body = ' ', text
+		}
+
+		switch kind {
+		case ' ':
+			oldLeft--
+			newLeft--
+		case '-':
+			oldLeft--
+		case '+':
+			newLeft--
+		case '\\':
+			markNoNewline(&h)
+			continue
+		default:
+			return Hunk{}, 0, fmt.Errorf("line %d: unexpected line in hunk: %q", i+1, strings.TrimRight(text, "\n"))
+		}
+		h.Lines = append(h.Lines, HunkLine{Kind: kind, Text: body})
+	}
+
+	if oldLeft != 0 || newLeft != 0 {
+		return Hunk{}, 0, fmt.Errorf("line %d: hunk is shorter than its header claims", start+1)
+	}
+
+	// A "\ No newline at end of file" marker may follow the last line
+	if i < len(lines) && strings.HasPrefix(lines[i], "\\") {
+		markNoNewline(&h)
+		i++
+	}
+
+	return h, i, nil
+}
+
+func markNoNewline(h *Hunk) {
+	if n := len(h.Lines); n > 0 {
+		last := &h.Lines[n-1]
+		last.Text = strings.TrimSuffix(strings.TrimSuffix(last.Text, "\n"), "\r")
+	}
+}
+
+// headerName extracts the file name from a ---/+++ line, dropping any
+// timestamp and the a/ or b/ prefix. /dev/null becomes "".
+func headerName(s string) string {
+	if i := strings.IndexByte(s, '\t'); i != -1 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return ""
+	}
+	return stripPrefix(s)
+}
+
+func stripPrefix(name string) string {
+	if strings.HasPrefix(name, "a/") || strings.HasPrefix(name, "b/") {
+		return name[2:]
+	}
+	return name
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// Apply applies the hunks to content in order. A hunk that does not match at
+// its stated line is searched for nearby, and with fuzz > 0 up to fuzz context
+// lines may be dropped from each end of the hunk. It returns the patched
+// content and one result per hunk; ok is false if any hunk failed.
+func (fp FilePatch) Apply(content string, fuzz int) (string, []HunkResult, bool) {
+	lines := SplitLines(content)
+	results := make([]HunkResult, len(fp.Hunks))
+	ok := true
+
+	// drift is how far the file has shifted from the hunk headers' numbering,
+	// through earlier hunks' insertions and deletions and their offsets
+	drift := 0
+	minPos := 0
+
+	for hi, h := range fp.Hunks {
+		results[hi] = HunkResult{Hunk: hi + 1}
+
+		var old, new []string
+		for _, l := range h.Lines {
+			if l.Kind != '+' {
+				old = append(old, l.Text)
+			}
+			if l.Kind != '-' {
+				new = append(new, l.Text)
+			}
+		}
+		lead, trail := contextRun(h.Lines, false), contextRun(h.Lines, true)
+
+		stated := h.OldStart - 1
+		if h.OldLines == 0 {
+			stated = h.OldStart
+		}
+
+		applied := false
+		for f := 0; f <= max(fuzz, 0) && !applied; f++ {
+			cutLead, cutTrail := min(f, lead), min(f, trail)
+			if f > 0 && cutLead == 0 && cutTrail == 0 {
+				break
+			}
+			o := old[cutLead : len(old)-cutTrail]
+			n := new[cutLead : len(new)-cutTrail]
+
+			want := stated + cutLead
+			pos := findLines(lines, o, want+drift, minPos)
+			if pos < 0 {
+				continue
+			}
+
+			patched := make([]string, 0, len(lines)-len(o)+len(n))
+			patched = append(patched, lines[:pos]...)
+			patched = append(patched, n...)
+			patched = append(patched, lines[pos+len(o):]...)
+			lines = patched
+
+			results[hi].Applied = true
+			results[hi].Offset = pos - want - drift
+			results[hi].Fuzz = f
+			drift = pos - want + len(n) - len(o)
+			minPos = pos + len(n)
+			applied = true
+		}
+
+		if !applied {
+			results[hi].Error = "hunk does not match file content"
+			ok = false
+		}
+	}
+
+	return strings.Join(lines, ""), results, ok
+}
+
+// contextRun counts the context lines at the start (or end) of a hunk
+func contextRun(lines []HunkLine, fromEnd bool) int {
+	n := 0
+	for i := range lines {
+		l := lines[i]
+		if fromEnd {
+			l = lines[len(lines)-1-i]
+		}
+		if l.Kind != ' ' {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// findLines returns the position at or after minPos closest to want where
+// target occurs in lines, or -1
+func findLines(lines, target []string, want, minPos int) int {
+	last := len(lines) - len(target)
+	if last < minPos {
+		return -1
+	}
+	want = min(max(want, minPos), last)
+
+	for d := 0; ; d++ {
+		before, after := want-d, want+d
+		if before < minPos && after > last {
+			return -1
+		}
+		if after <= last && linesMatch(lines[after:], target) {
+			return after
+		}
+		if d > 0 && before >= minPos && linesMatch(lines[before:], target) {
+			return before
+		}
+	}
+}
+
+func linesMatch(lines, target []string) bool {
+	for i, t := range target {
+		if lines[i] != t {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package diff
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	patch := `commit message to ignore
+diff --git a/old.txt b/new.txt
+similarity index 90%
+rename from old.txt
+rename to new.txt
+--- a/old.txt
++++ b/new.txt
+@@ -1,2 +1,2 @@
+ keep
+-gone
++added
+diff --git a/created.txt b/created.txt
+new file mode 100644
+--- /dev/null
++++ b/created.txt
+@@ -0,0 +1 @@
++hello
+\ No newline at end of file
+--- a/removed.txt	2024-01-01 00:00:00
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+`
+	patches, err := Parse(patch)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(patches) != 3 {
+		t.Fatalf("got %d patches, want 3", len(patches))
+	}
+
+	if !patches[0].IsRename() || patches[0].OldName != "old.txt" || patches[0].NewName != "new.txt" {
+		t.Errorf("unexpected rename patch: %+v", patches[0])
+	}
+	if len(patches[0].Hunks) != 1 || len(patches[0].Hunks[0].Lines) != 3 {
+		t.Errorf("unexpected hunks: %+v", patches[0].Hunks)
+	}
+
+	if !patches[1].IsCreate() || patches[1].NewName != "created.txt" {
+		t.Errorf("unexpected create patch: %+v", patches[1])
+	}
+	if got := patches[1].Hunks[0].Lines[0].Text; got != "hello" {
+		t.Errorf("got line %q, want %q without newline", got, "hello")
+	}
+
+	if !patches[2].IsDelete() || patches[2].OldName != "removed.txt" {
+		t.Errorf("unexpected delete patch: %+v", patches[2])
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := Parse("just some text\n"); err != ErrNoPatch {
+		t.Errorf("got %v, want ErrNoPatch", err)
+	}
+	if _, err := Parse("--- a/x\n+++ b/x\n@@ -1,3 +1,3 @@\n a\n"); err == nil {
+		t.Error("expected an error for truncated hunk")
+	}
+}
+
+func TestApplyOffsetAndFuzz(t *testing.T) {
+	patches, _ := Parse("--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n")
+	fp := patches[0]
+
+	// Two extra lines at the top shift the hunk down
+	got, results, ok := fp.Apply("x\ny\na\nb\nc\n", 0)
+	if !ok || got != "x\ny\na\nB\nc\n" {
+		t.Fatalf("got %q ok=%v", got, ok)
+	}
+	if results[0].Offset != 2 {
+		t.Errorf("got offset %d, want 2", results[0].Offset)
+	}
+
+	// Changed leading context only applies with fuzz
+	if _, _, ok := fp.Apply("A\nb\nc\n", 0); ok {
+		t.Error("expected failure without fuzz")
+	}
+	got, results, ok = fp.Apply("A\nb\nc\n", 1)
+	if !ok || got != "A\nB\nc\n" || results[0].Fuzz != 1 {
+		t.Errorf("got %q ok=%v fuzz=%d", got, ok, results[0].Fuzz)
+	}
+}
+
+func TestParseMissingFinalNewline(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		in    string
+		want  string
+	}{
+		{
+			name:  "last line keeps its newline",
+			patch: "--- a/x\n+++ b/x\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c",
+			in:    "a\nb\nc\nd\n",
+			want:  "a\nB\nc\nd\n",
+		},
+		{
+			name:  "marker still drops it",
+			patch: "--- a/x\n+++ b/x\n@@ -1,2 +1,2 @@\n a\n-b\n+B\n\\ No newline at end of file",
+			in:    "a\nb\n",
+			want:  "a\nB",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patches, err := Parse(tt.patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, results, ok := patches[0].Apply(tt.in, 0)
+			if !ok || got != tt.want {
+				t.Errorf("got %q ok=%v results=%+v, want %q", got, ok, results, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	words := []string{"alpha\n", "beta\n", "gamma\n", "delta\n", "eps\n"}
+	randText := func() string {
+		var b strings.Builder
+		for range rng.Intn(40) {
+			b.WriteString(words[rng.Intn(len(words))])
+		}
+		return b.String()
+	}
+
+	for i := 0; i < 200; i++ {
+		from, to := randText(), randText()
+		if rng.Intn(4) == 0 {
+			to = strings.TrimSuffix(to, "\n")
+		}
+		patch := Unified("a/f", "b/f", from, to, rng.Intn(4))
+		if patch == "" {
+			continue
+		}
+
+		patches, err := Parse(patch)
+		if err != nil {
+			t.Fatalf("parse failed: %v\n%s", err, patch)
+		}
+		got, _, ok := patches[0].Apply(from, 0)
+		if !ok || got != to {
+			t.Fatalf("round trip failed\nfrom %q\nto   %q\ngot  %q\npatch:\n%s", from, to, got, patch)
+		}
+	}
+}
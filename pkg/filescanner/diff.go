@@ -0,0 +1,146 @@
+package filescanner
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/phillip-england/engl/pkg/diff"
+	"github.com/phillip-england/engl/pkg/pathutil"
+)
+
+type DiffRequest struct {
+	Path      string  `json:"path"`
+	OtherPath string  `json:"other_path,omitempty"`
+	Content   *string `json:"content,omitempty"`
+	Context   *int    `json:"context,omitempty"`
+	WordDiff  bool    `json:"word_diff"`
+}
+
+type DiffResponse struct {
+	Diff      string `json:"diff"`
+	Identical bool   `json:"identical"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DiffHandler returns a unified diff between two files, or between a file
+// and proposed content
+func DiffHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DiffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDiffError(w, "Invalid JSON body")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Path == "" {
+		writeDiffError(w, "path is required")
+		return
+	}
+
+	if (req.OtherPath == "") == (req.Content == nil) {
+		writeDiffError(w, "exactly one of other_path or content is required")
+		return
+	}
+
+	validPath, err := pathutil.ValidatePath(req.Path)
+	if err != nil {
+		writeDiffError(w, "access denied: "+err.Error())
+		return
+	}
+
+	log.Printf("HIT: %s | Path: %s", r.URL.Path, validPath)
+
+	toPath := validPath
+	if req.OtherPath != "" {
+		toPath, err = pathutil.ValidatePath(req.OtherPath)
+		if err != nil {
+			writeDiffError(w, "access denied: "+err.Error())
+			return
+		}
+	}
+
+	var from, to string
+	if req.Content != nil {
+		// A missing file diffs as empty so new files can be previewed too
+		from, err = readTextFile(validPath, true)
+		if err != nil {
+			writeDiffError(w, err.Error())
+			return
+		}
+		to = *req.Content
+	} else {
+		if from, err = readTextFile(validPath, false); err != nil {
+			writeDiffError(w, err.Error())
+			return
+		}
+		if to, err = readTextFile(toPath, false); err != nil {
+			writeDiffError(w, err.Error())
+			return
+		}
+	}
+
+	context := diff.DefaultContext
+	if req.Context != nil {
+		context = *req.Context
+	}
+
+	fromName := "a/" + displayPath(validPath)
+	toName := "b/" + displayPath(toPath)
+
+	var out string
+	if req.WordDiff {
+		out = diff.WordUnified(fromName, toName, from, to, context)
+	} else {
+		out = diff.Unified(fromName, toName, from, to, context)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DiffResponse{Diff: out, Identical: out == ""})
+}
+
+// readTextFile reads a regular file for diffing. When allowMissing is set a
+// nonexistent file reads as empty.
+func readTextFile(path string, allowMissing bool) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if allowMissing && os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if info.IsDir() {
+		return "", errIsDirectory
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if isBinary(data) {
+		return "", errBinaryFile
+	}
+	return string(data), nil
+}
+
+// displayPath returns path relative to the allowed root, using forward slashes
+func displayPath(path string) string {
+	rel, err := filepath.Rel(pathutil.GetAllowedRoot(), path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func writeDiffError(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(DiffResponse{Error: msg})
+}
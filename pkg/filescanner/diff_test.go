@@ -0,0 +1,141 @@
+package filescanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	oldFile := filepath.Join(tmpDir, "old.txt")
+	newFile := filepath.Join(tmpDir, "new.txt")
+	os.WriteFile(oldFile, []byte("one\ntwo\nthree\n"), 0644)
+	os.WriteFile(newFile, []byte("one\n2\nthree\n"), 0644)
+
+	strPtr := func(s string) *string { return &s }
+	intPtr := func(i int) *int { return &i }
+
+	tests := []struct {
+		name       string
+		method     string
+		body       any
+		wantStatus int
+		checkResp  func(*testing.T, DiffResponse)
+	}{
+		{
+			name:       "two files",
+			method:     http.MethodPost,
+			body:       DiffRequest{Path: oldFile, OtherPath: newFile, Context: intPtr(0)},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp DiffResponse) {
+				want := "--- a/old.txt\n+++ b/new.txt\n@@ -2 +2 @@\n-two\n+2\n"
+				if resp.Diff != want {
+					t.Errorf("got diff:\n%s\nwant:\n%s", resp.Diff, want)
+				}
+			},
+		},
+		{
+			name:       "proposed content",
+			method:     http.MethodPost,
+			body:       DiffRequest{Path: oldFile, Content: strPtr("one\ntwo\nthree\nfour\n")},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp DiffResponse) {
+				want := "--- a/old.txt\n+++ b/old.txt\n@@ -1,3 +1,4 @@\n one\n two\n three\n+four\n"
+				if resp.Diff != want {
+					t.Errorf("got diff:\n%s\nwant:\n%s", resp.Diff, want)
+				}
+			},
+		},
+		{
+			name:       "new file",
+			method:     http.MethodPost,
+			body:       DiffRequest{Path: filepath.Join(tmpDir, "missing.txt"), Content: strPtr("hi\n")},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp DiffResponse) {
+				want := "--- a/missing.txt\n+++ b/missing.txt\n@@ -0,0 +1 @@\n+hi\n"
+				if resp.Diff != want {
+					t.Errorf("got diff:\n%s\nwant:\n%s", resp.Diff, want)
+				}
+			},
+		},
+		{
+			name:       "identical",
+			method:     http.MethodPost,
+			body:       DiffRequest{Path: oldFile, OtherPath: oldFile},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp DiffResponse) {
+				if !resp.Identical || resp.Diff != "" {
+					t.Errorf("expected identical, got %q", resp.Diff)
+				}
+			},
+		},
+		{
+			name:       "word diff",
+			method:     http.MethodPost,
+			body:       DiffRequest{Path: oldFile, Content: strPtr("one\ntwo 2\nthree\n"), Context: intPtr(0), WordDiff: true},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp DiffResponse) {
+				want := "--- a/old.txt\n+++ b/old.txt\n@@ -2 +2 @@\ntwo{+ 2+}\n"
+				if resp.Diff != want {
+					t.Errorf("got diff:\n%s\nwant:\n%s", resp.Diff, want)
+				}
+			},
+		},
+		{
+			name:       "both targets",
+			method:     http.MethodPost,
+			body:       DiffRequest{Path: oldFile, OtherPath: newFile, Content: strPtr("x")},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp DiffResponse) {
+				if resp.Error != "exactly one of other_path or content is required" {
+					t.Errorf("got error %q", resp.Error)
+				}
+			},
+		},
+		{
+			name:       "other path outside root",
+			method:     http.MethodPost,
+			body:       DiffRequest{Path: oldFile, OtherPath: "/etc/passwd"},
+			wantStatus: http.StatusBadRequest,
+			checkResp:  nil,
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodGet,
+			body:       nil,
+			wantStatus: http.StatusMethodNotAllowed,
+			checkResp:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			if tt.body != nil {
+				json.NewEncoder(&body).Encode(tt.body)
+			}
+
+			req := httptest.NewRequest(tt.method, "/mcp/tool/file_scanner/diff", &body)
+			rec := httptest.NewRecorder()
+
+			DiffHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			if tt.checkResp != nil {
+				var resp DiffResponse
+				json.NewDecoder(rec.Body).Decode(&resp)
+				tt.checkResp(t, resp)
+			}
+		})
+	}
+}
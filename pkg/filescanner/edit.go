@@ -0,0 +1,183 @@
+package filescanner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/phillip-england/engl/pkg/diff"
+	"github.com/phillip-england/engl/pkg/fileutil"
+	"github.com/phillip-england/engl/pkg/history"
+	"github.com/phillip-england/engl/pkg/pathutil"
+	"github.com/phillip-england/engl/pkg/quota"
+)
+
+var (
+	errOldStringNotFound = errors.New("old_string not found in file")
+	errNoChange          = errors.New("old_string and new_string are identical")
+)
+
+// EditRequest replaces OldString with NewString. Format and Validate work as
+// in WriteRequest and apply to the file as it reads after the edit.
+type EditRequest struct {
+	Path            string     `json:"path"`
+	OldString       string     `json:"old_string"`
+	NewString       string     `json:"new_string"`
+	ReplaceAll      bool       `json:"replace_all"`
+	Format          bool       `json:"format,omitempty"`
+	Validate        string     `json:"validate,omitempty"`
+	ExpectedHash    string     `json:"expected_hash,omitempty"`
+	ExpectedModTime *time.Time `json:"expected_mtime,omitempty"`
+}
+
+type EditResponse struct {
+	Success      bool          `json:"success"`
+	Replacements int           `json:"replacements,omitempty"`
+	Diff         string        `json:"diff,omitempty"`
+	Hash         string        `json:"hash,omitempty"`
+	Conflict     bool          `json:"conflict,omitempty"`
+	CurrentHash  string        `json:"current_hash,omitempty"`
+	SyntaxErrors []SyntaxError `json:"syntax_errors,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// EditHandler replaces an exact string in a file and returns a diff of the change
+func EditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req EditRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeEditError(w, "Invalid JSON body")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Path == "" {
+		writeEditError(w, "path is required")
+		return
+	}
+
+	if req.OldString == "" {
+		writeEditError(w, "old_string is required")
+		return
+	}
+
+	validPath, err := pathutil.ValidateWritePath(req.Path)
+	if err != nil {
+		writeEditError(w, "access denied: "+err.Error())
+		return
+	}
+
+	log.Printf("HIT: %s | Path: %s", r.URL.Path, validPath)
+
+	unlock := fileutil.LockPath(validPath)
+	defer unlock()
+
+	if current, err := fileutil.CheckVersion(validPath, req.ExpectedHash, req.ExpectedModTime); err != nil {
+		if errors.Is(err, fileutil.ErrConflict) {
+			writeEditConflict(w, current)
+			return
+		}
+		writeEditError(w, err.Error())
+		return
+	}
+
+	before, err := readTextFile(validPath, false)
+	if err != nil {
+		writeEditError(w, err.Error())
+		return
+	}
+
+	after, count, err := replaceString(before, req.OldString, req.NewString, req.ReplaceAll)
+	if err != nil {
+		writeEditError(w, err.Error())
+		return
+	}
+
+	checked, syntaxErrs, err := checkContent(validPath, []byte(after), req.Format, req.Validate)
+	if err != nil {
+		if errors.Is(err, errSyntax) {
+			writeEditSyntaxError(w, syntaxErrs)
+			return
+		}
+		writeEditError(w, err.Error())
+		return
+	}
+	after = string(checked)
+
+	charge, err := quota.Check(quota.Change{Path: validPath, Size: int64(len(after)), Partial: true})
+	if err != nil {
+		writeEditError(w, err.Error())
+		return
+	}
+	defer charge.Release()
+
+	if err := history.Snapshot(validPath, "edit"); err != nil {
+		writeEditError(w, "history snapshot failed: "+err.Error())
+		return
+	}
+
+	if err := fileutil.WriteFile(validPath, []byte(after), 0644); err != nil {
+		writeEditError(w, err.Error())
+		return
+	}
+	charge.Commit()
+
+	name := displayPath(validPath)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EditResponse{
+		Success:      true,
+		Replacements: count,
+		Diff:         diff.Unified("a/"+name, "b/"+name, before, after, diff.DefaultContext),
+		Hash:         fileutil.Hash([]byte(after)),
+		SyntaxErrors: syntaxErrs,
+	})
+}
+
+// replaceString replaces old with new in content. Unless replaceAll is set,
+// old must occur exactly once so the edit cannot land in the wrong place.
+func replaceString(content, old, new string, replaceAll bool) (string, int, error) {
+	if old == new {
+		return "", 0, errNoChange
+	}
+
+	count := strings.Count(content, old)
+	if count == 0 {
+		return "", 0, errOldStringNotFound
+	}
+	if count > 1 && !replaceAll {
+		return "", 0, fmt.Errorf("old_string is ambiguous: found %d occurrences; add surrounding context or set replace_all", count)
+	}
+
+	return strings.ReplaceAll(content, old, new), count, nil
+}
+
+func writeEditError(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(EditResponse{Error: msg})
+}
+
+func writeEditSyntaxError(w http.ResponseWriter, errs []SyntaxError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(EditResponse{Error: errSyntax.Error(), SyntaxErrors: errs})
+}
+
+func writeEditConflict(w http.ResponseWriter, currentHash string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(EditResponse{
+		Conflict:    true,
+		CurrentHash: currentHash,
+		Error:       fileutil.ErrConflict.Error(),
+	})
+}
@@ -0,0 +1,188 @@
+package filescanner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/phillip-england/engl/pkg/diff"
+	"github.com/phillip-england/engl/pkg/fileutil"
+	"github.com/phillip-england/engl/pkg/history"
+	"github.com/phillip-england/engl/pkg/pathutil"
+	"github.com/phillip-england/engl/pkg/quota"
+)
+
+const (
+	LineOpInsert  = "insert"  // insert content before start_line
+	LineOpReplace = "replace" // replace start_line..end_line with content
+	LineOpDelete  = "delete"  // delete start_line..end_line
+)
+
+var errExpectedContent = errors.New("lines do not match expected_content")
+
+// EditLinesRequest edits a file by 1-based, inclusive line numbers, as shown
+// by a line-numbered read. ExpectedContent, when set, must equal the lines
+// being replaced or deleted. Format and Validate work as in WriteRequest.
+type EditLinesRequest struct {
+	Path            string     `json:"path"`
+	Operation       string     `json:"operation"`
+	StartLine       int        `json:"start_line"`
+	EndLine         int        `json:"end_line"`
+	Content         string     `json:"content"`
+	ExpectedContent *string    `json:"expected_content,omitempty"`
+	Format          bool       `json:"format,omitempty"`
+	Validate        string     `json:"validate,omitempty"`
+	ExpectedHash    string     `json:"expected_hash,omitempty"`
+	ExpectedModTime *time.Time `json:"expected_mtime,omitempty"`
+}
+
+// EditLinesHandler inserts, replaces or deletes a range of lines in a file
+func EditLinesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req EditLinesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeEditError(w, "Invalid JSON body")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Path == "" {
+		writeEditError(w, "path is required")
+		return
+	}
+
+	validPath, err := pathutil.ValidateWritePath(req.Path)
+	if err != nil {
+		writeEditError(w, "access denied: "+err.Error())
+		return
+	}
+
+	log.Printf("HIT: %s | Path: %s | Op: %s %d-%d", r.URL.Path, validPath, req.Operation, req.StartLine, req.EndLine)
+
+	unlock := fileutil.LockPath(validPath)
+	defer unlock()
+
+	if current, err := fileutil.CheckVersion(validPath, req.ExpectedHash, req.ExpectedModTime); err != nil {
+		if errors.Is(err, fileutil.ErrConflict) {
+			writeEditConflict(w, current)
+			return
+		}
+		writeEditError(w, err.Error())
+		return
+	}
+
+	before, err := readTextFile(validPath, false)
+	if err != nil {
+		writeEditError(w, err.Error())
+		return
+	}
+
+	after, err := editLines(before, req)
+	if err != nil {
+		writeEditError(w, err.Error())
+		return
+	}
+
+	checked, syntaxErrs, err := checkContent(validPath, []byte(after), req.Format, req.Validate)
+	if err != nil {
+		if errors.Is(err, errSyntax) {
+			writeEditSyntaxError(w, syntaxErrs)
+			return
+		}
+		writeEditError(w, err.Error())
+		return
+	}
+	after = string(checked)
+
+	charge, err := quota.Check(quota.Change{Path: validPath, Size: int64(len(after)), Partial: true})
+	if err != nil {
+		writeEditError(w, err.Error())
+		return
+	}
+	defer charge.Release()
+
+	if err := history.Snapshot(validPath, "edit_lines"); err != nil {
+		writeEditError(w, "history snapshot failed: "+err.Error())
+		return
+	}
+
+	if err := fileutil.WriteFile(validPath, []byte(after), 0644); err != nil {
+		writeEditError(w, err.Error())
+		return
+	}
+	charge.Commit()
+
+	name := displayPath(validPath)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EditResponse{
+		Success:      true,
+		Diff:         diff.Unified("a/"+name, "b/"+name, before, after, diff.DefaultContext),
+		Hash:         fileutil.Hash([]byte(after)),
+		SyntaxErrors: syntaxErrs,
+	})
+}
+
+// editLines applies a line-range operation to content
+func editLines(content string, req EditLinesRequest) (string, error) {
+	lines := diff.SplitLines(content)
+	n := len(lines)
+
+	var start, end int // 0-based half-open range being removed
+	switch req.Operation {
+	case LineOpInsert:
+		if req.StartLine < 1 || req.StartLine > n+1 {
+			return "", fmt.Errorf("start_line %d out of range: file has %d lines", req.StartLine, n)
+		}
+		if req.ExpectedContent != nil {
+			return "", errors.New("expected_content is not supported for insert")
+		}
+		start, end = req.StartLine-1, req.StartLine-1
+	case LineOpReplace, LineOpDelete:
+		if req.StartLine < 1 || req.EndLine < req.StartLine || req.EndLine > n {
+			return "", fmt.Errorf("line range %d-%d out of range: file has %d lines", req.StartLine, req.EndLine, n)
+		}
+		start, end = req.StartLine-1, req.EndLine
+	default:
+		return "", errors.New("invalid operation: " + req.Operation)
+	}
+
+	if req.ExpectedContent != nil {
+		got := strings.Join(lines[start:end], "")
+		if strings.TrimSuffix(got, "\n") != strings.TrimSuffix(*req.ExpectedContent, "\n") {
+			return "", errExpectedContent
+		}
+	}
+
+	insert := ""
+	if req.Operation != LineOpDelete {
+		insert = req.Content
+		if insert != "" && !strings.HasSuffix(insert, "\n") {
+			insert += "\n"
+		}
+	}
+
+	// Keep a missing final newline missing when the edit reaches the end
+	if end == n && n > 0 && !strings.HasSuffix(lines[n-1], "\n") {
+		switch {
+		case start == n && insert != "":
+			lines[n-1] += "\n"
+			insert = strings.TrimSuffix(insert, "\n")
+		case start < n:
+			insert = strings.TrimSuffix(insert, "\n")
+			if insert == "" && start > 0 {
+				lines[start-1] = strings.TrimSuffix(lines[start-1], "\n")
+			}
+		}
+	}
+
+	return strings.Join(lines[:start], "") + insert + strings.Join(lines[end:], ""), nil
+}
@@ -0,0 +1,131 @@
+package filescanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEditLines(t *testing.T) {
+	strPtr := func(s string) *string { return &s }
+
+	tests := []struct {
+		name    string
+		content string
+		req     EditLinesRequest
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "insert before line",
+			content: "a\nb\nc\n",
+			req:     EditLinesRequest{Operation: LineOpInsert, StartLine: 2, Content: "x"},
+			want:    "a\nx\nb\nc\n",
+		},
+		{
+			name:    "insert at end",
+			content: "a\nb\n",
+			req:     EditLinesRequest{Operation: LineOpInsert, StartLine: 3, Content: "c\nd\n"},
+			want:    "a\nb\nc\nd\n",
+		},
+		{
+			name:    "insert at end without final newline",
+			content: "a\nb",
+			req:     EditLinesRequest{Operation: LineOpInsert, StartLine: 3, Content: "c"},
+			want:    "a\nb\nc",
+		},
+		{
+			name:    "replace range",
+			content: "a\nb\nc\nd\n",
+			req:     EditLinesRequest{Operation: LineOpReplace, StartLine: 2, EndLine: 3, Content: "B\n"},
+			want:    "a\nB\nd\n",
+		},
+		{
+			name:    "replace with expected content",
+			content: "a\nb\nc\n",
+			req:     EditLinesRequest{Operation: LineOpReplace, StartLine: 2, EndLine: 2, Content: "B", ExpectedContent: strPtr("b")},
+			want:    "a\nB\nc\n",
+		},
+		{
+			name:    "expected content mismatch",
+			content: "a\nb\nc\n",
+			req:     EditLinesRequest{Operation: LineOpReplace, StartLine: 2, EndLine: 2, Content: "B", ExpectedContent: strPtr("x")},
+			wantErr: "lines do not match expected_content",
+		},
+		{
+			name:    "delete last lines without final newline",
+			content: "a\nb\nc",
+			req:     EditLinesRequest{Operation: LineOpDelete, StartLine: 2, EndLine: 3},
+			want:    "a",
+		},
+		{
+			name:    "range out of bounds",
+			content: "a\n",
+			req:     EditLinesRequest{Operation: LineOpDelete, StartLine: 1, EndLine: 2},
+			wantErr: "line range 1-2 out of range: file has 1 lines",
+		},
+		{
+			name:    "invalid operation",
+			content: "a\n",
+			req:     EditLinesRequest{Operation: "move", StartLine: 1},
+			wantErr: "invalid operation: move",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := editLines(tt.content, tt.req)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditLinesHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	path := filepath.Join(tmpDir, "file.txt")
+	os.WriteFile(path, []byte("one\ntwo\nthree\n"), 0644)
+
+	var body bytes.Buffer
+	json.NewEncoder(&body).Encode(EditLinesRequest{Path: path, Operation: LineOpDelete, StartLine: 2, EndLine: 2})
+	rec := httptest.NewRecorder()
+	EditLinesHandler(rec, httptest.NewRequest(http.MethodPost, "/mcp/tool/file_scanner/edit_lines", &body))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var resp EditResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	want := "--- a/file.txt\n+++ b/file.txt\n@@ -1,3 +1,2 @@\n one\n-two\n three\n"
+	if resp.Diff != want {
+		t.Errorf("got diff:\n%s\nwant:\n%s", resp.Diff, want)
+	}
+
+	content, _ := os.ReadFile(path)
+	if string(content) != "one\nthree\n" {
+		t.Errorf("got content %q, want %q", content, "one\nthree\n")
+	}
+
+	rec = httptest.NewRecorder()
+	EditLinesHandler(rec, httptest.NewRequest(http.MethodGet, "/mcp/tool/file_scanner/edit_lines", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
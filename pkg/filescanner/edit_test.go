@@ -0,0 +1,143 @@
+package filescanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEditHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	path := filepath.Join(tmpDir, "main.go")
+	os.WriteFile(path, []byte("a := 1\nb := 1\nc := 2\n"), 0644)
+
+	tests := []struct {
+		name       string
+		method     string
+		body       any
+		wantStatus int
+		checkResp  func(*testing.T, EditResponse)
+		wantFile   string
+	}{
+		{
+			name:       "ambiguous",
+			method:     http.MethodPost,
+			body:       EditRequest{Path: path, OldString: ":= 1", NewString: ":= 3"},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp EditResponse) {
+				want := "old_string is ambiguous: found 2 occurrences; add surrounding context or set replace_all"
+				if resp.Error != want {
+					t.Errorf("got error %q, want %q", resp.Error, want)
+				}
+			},
+			wantFile: "a := 1\nb := 1\nc := 2\n",
+		},
+		{
+			name:       "unique replace",
+			method:     http.MethodPost,
+			body:       EditRequest{Path: path, OldString: "c := 2", NewString: "c := 4"},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp EditResponse) {
+				if !resp.Success || resp.Replacements != 1 {
+					t.Errorf("got success=%v replacements=%d", resp.Success, resp.Replacements)
+				}
+				want := "--- a/main.go\n+++ b/main.go\n@@ -1,3 +1,3 @@\n a := 1\n b := 1\n-c := 2\n+c := 4\n"
+				if resp.Diff != want {
+					t.Errorf("got diff:\n%s\nwant:\n%s", resp.Diff, want)
+				}
+			},
+			wantFile: "a := 1\nb := 1\nc := 4\n",
+		},
+		{
+			name:       "replace all",
+			method:     http.MethodPost,
+			body:       EditRequest{Path: path, OldString: ":= 1", NewString: ":= 3", ReplaceAll: true},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp EditResponse) {
+				if resp.Replacements != 2 {
+					t.Errorf("got %d replacements, want 2", resp.Replacements)
+				}
+			},
+			wantFile: "a := 3\nb := 3\nc := 4\n",
+		},
+		{
+			name:       "not found",
+			method:     http.MethodPost,
+			body:       EditRequest{Path: path, OldString: "missing", NewString: "x"},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp EditResponse) {
+				if resp.Error != "old_string not found in file" {
+					t.Errorf("got error %q", resp.Error)
+				}
+			},
+			wantFile: "a := 3\nb := 3\nc := 4\n",
+		},
+		{
+			name:       "stale hash",
+			method:     http.MethodPost,
+			body:       EditRequest{Path: path, OldString: "a", NewString: "z", ExpectedHash: "deadbeef"},
+			wantStatus: http.StatusConflict,
+			checkResp: func(t *testing.T, resp EditResponse) {
+				if !resp.Conflict || resp.CurrentHash == "" {
+					t.Errorf("expected conflict with current hash, got %+v", resp)
+				}
+			},
+			wantFile: "a := 3\nb := 3\nc := 4\n",
+		},
+		{
+			name:       "missing old string",
+			method:     http.MethodPost,
+			body:       EditRequest{Path: path, NewString: "x"},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp EditResponse) {
+				if resp.Error != "old_string is required" {
+					t.Errorf("got error %q", resp.Error)
+				}
+			},
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodGet,
+			body:       nil,
+			wantStatus: http.StatusMethodNotAllowed,
+			checkResp:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			if tt.body != nil {
+				json.NewEncoder(&body).Encode(tt.body)
+			}
+
+			req := httptest.NewRequest(tt.method, "/mcp/tool/file_scanner/edit", &body)
+			rec := httptest.NewRecorder()
+
+			EditHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			if tt.checkResp != nil {
+				var resp EditResponse
+				json.NewDecoder(rec.Body).Decode(&resp)
+				tt.checkResp(t, resp)
+			}
+
+			if tt.wantFile != "" {
+				content, _ := os.ReadFile(path)
+				if string(content) != tt.wantFile {
+					t.Errorf("got file %q, want %q", content, tt.wantFile)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package filescanner
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/phillip-england/engl/pkg/pathutil"
+)
+
+const defaultFindLimit = 20
+
+// Fuzzy scoring weights. Every matched character earns scoreMatch plus any
+// bonus for where it landed; skipped characters between matches cost gapPenalty.
+const (
+	scoreMatch       = 16
+	bonusSegment     = 12 // first character of a path segment
+	bonusBoundary    = 8  // after _ - . or a space, or a camelCase hump
+	bonusConsecutive = 8
+	bonusBasename    = 4
+	gapPenalty       = 1
+)
+
+type FindRequest struct {
+	Query string `json:"query"`
+	Path  string `json:"path"`
+	Limit int    `json:"limit"`
+}
+
+type FindMatch struct {
+	Path    string `json:"path"`
+	RelPath string `json:"rel_path"`
+	Score   int    `json:"score"`
+}
+
+type FindResponse struct {
+	Matches []FindMatch `json:"matches"`
+	Total   int         `json:"total"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// FindHandler ranks file paths under a directory against a fuzzy query
+func FindHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req FindRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFindError(w, "Invalid JSON body")
+		return
+	}
+	defer r.Body.Close()
+
+	query := normalizeQuery(req.Query)
+	if query == "" {
+		writeFindError(w, "query is required")
+		return
+	}
+
+	if req.Path == "" {
+		req.Path = pathutil.GetAllowedRoot()
+	}
+
+	validPath, err := pathutil.ValidatePath(req.Path)
+	if err != nil {
+		writeFindError(w, "access denied: "+err.Error())
+		return
+	}
+
+	if req.Limit <= 0 {
+		req.Limit = defaultFindLimit
+	}
+
+	log.Printf("HIT: %s | Path: %s | Query: %s", r.URL.Path, validPath, req.Query)
+
+	files, err := collectFiles(validPath, "")
+	if err != nil {
+		writeFindError(w, err.Error())
+		return
+	}
+
+	matches := []FindMatch{}
+	for _, file := range files {
+		rel, err := filepath.Rel(validPath, file)
+		if err != nil || rel == "." {
+			rel = filepath.Base(file)
+		}
+		rel = filepath.ToSlash(rel)
+
+		score, ok := fuzzyScore(query, rel)
+		if !ok {
+			continue
+		}
+		matches = append(matches, FindMatch{Path: file, RelPath: rel, Score: score})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		if len(matches[i].RelPath) != len(matches[j].RelPath) {
+			return len(matches[i].RelPath) < len(matches[j].RelPath)
+		}
+		return matches[i].RelPath < matches[j].RelPath
+	})
+
+	total := len(matches)
+	if len(matches) > req.Limit {
+		matches = matches[:req.Limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FindResponse{Matches: matches, Total: total})
+}
+
+// normalizeQuery lowercases the query and drops whitespace, so "handler test"
+// is matched as the subsequence "handlertest".
+func normalizeQuery(q string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, q)
+}
+
+// fuzzyScore finds the best-scoring way to match query as a subsequence of
+// candidate. query must already be normalized. It returns false when query is
+// not a subsequence of candidate.
+func fuzzyScore(query, candidate string) (int, bool) {
+	q := []rune(query)
+	c := []rune(candidate)
+	lower := []rune(strings.ToLower(candidate))
+
+	if !isSubsequence(q, lower) {
+		return 0, false
+	}
+
+	baseStart := strings.LastIndex(candidate, "/") + 1
+	baseStart = len([]rune(candidate[:baseStart]))
+
+	bonus := make([]int, len(c))
+	for j := range c {
+		bonus[j] = positionBonus(c, j)
+		if j >= baseStart {
+			bonus[j] += bonusBasename
+		}
+	}
+
+	const none = -1 << 30
+	prev := make([]int, len(c))
+	cur := make([]int, len(c))
+	for j := range c {
+		prev[j] = none
+		if lower[j] == q[0] {
+			prev[j] = scoreMatch + bonus[j]
+		}
+	}
+
+	for i := 1; i < len(q); i++ {
+		// bestGap tracks max(prev[k] + k*gapPenalty) over k < j-1, so the
+		// gapped transition into j costs one pass instead of a scan over k.
+		bestGap := none
+		for j := range c {
+			cur[j] = none
+			if j >= 2 && prev[j-2] != none {
+				bestGap = max(bestGap, prev[j-2]+(j-2)*gapPenalty)
+			}
+			if lower[j] != q[i] {
+				continue
+			}
+			best := none
+			if j >= 1 && prev[j-1] != none {
+				best = prev[j-1] + bonusConsecutive
+			}
+			if bestGap != none {
+				best = max(best, bestGap-(j-1)*gapPenalty)
+			}
+			if best != none {
+				cur[j] = best + scoreMatch + bonus[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	score := none
+	for _, s := range prev {
+		score = max(score, s)
+	}
+	return score, score != none
+}
+
+func isSubsequence(q, c []rune) bool {
+	i := 0
+	for _, r := range c {
+		if i < len(q) && r == q[i] {
+			i++
+		}
+	}
+	return i == len(q)
+}
+
+func positionBonus(c []rune, j int) int {
+	if j == 0 || c[j-1] == '/' {
+		return bonusSegment
+	}
+	switch c[j-1] {
+	case '_', '-', '.', ' ':
+		return bonusBoundary
+	}
+	if unicode.IsUpper(c[j]) && unicode.IsLower(c[j-1]) {
+		return bonusBoundary
+	}
+	return 0
+}
+
+func writeFindError(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(FindResponse{Error: msg})
+}
@@ -0,0 +1,137 @@
+package filescanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	for _, rel := range []string{
+		"main.go",
+		"pkg/filescanner/handler.go",
+		"pkg/filescanner/handler_test.go",
+		"pkg/shell/handler.go",
+		"pkg/pathutil/validate.go",
+		"node_modules/handler_test.go",
+	} {
+		path := filepath.Join(tmpDir, rel)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(""), 0644)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		body       any
+		wantStatus int
+		checkResp  func(*testing.T, FindResponse)
+	}{
+		{
+			name:       "words rank matching basename first",
+			method:     http.MethodPost,
+			body:       FindRequest{Query: "handler test"},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp FindResponse) {
+				if resp.Error != "" {
+					t.Errorf("unexpected error: %s", resp.Error)
+				}
+				if len(resp.Matches) != 1 {
+					t.Fatalf("got %d matches, want 1", len(resp.Matches))
+				}
+				if resp.Matches[0].RelPath != "pkg/filescanner/handler_test.go" {
+					t.Errorf("got %s, want pkg/filescanner/handler_test.go", resp.Matches[0].RelPath)
+				}
+			},
+		},
+		{
+			name:       "segment boundaries outrank scattered matches",
+			method:     http.MethodPost,
+			body:       FindRequest{Query: "shh"},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp FindResponse) {
+				if len(resp.Matches) == 0 || resp.Matches[0].RelPath != "pkg/shell/handler.go" {
+					t.Errorf("got %+v, want pkg/shell/handler.go first", resp.Matches)
+				}
+			},
+		},
+		{
+			name:       "limit",
+			method:     http.MethodPost,
+			body:       FindRequest{Query: "go", Limit: 2},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp FindResponse) {
+				if len(resp.Matches) != 2 || resp.Total != 5 {
+					t.Errorf("got %d matches of %d, want 2 of 5", len(resp.Matches), resp.Total)
+				}
+			},
+		},
+		{
+			name:       "missing query",
+			method:     http.MethodPost,
+			body:       FindRequest{Query: "  "},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp FindResponse) {
+				if resp.Error != "query is required" {
+					t.Errorf("got error %q, want %q", resp.Error, "query is required")
+				}
+			},
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodGet,
+			body:       nil,
+			wantStatus: http.StatusMethodNotAllowed,
+			checkResp:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			if tt.body != nil {
+				json.NewEncoder(&body).Encode(tt.body)
+			}
+
+			req := httptest.NewRequest(tt.method, "/mcp/tool/file_scanner/find", &body)
+			rec := httptest.NewRecorder()
+
+			FindHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			if tt.checkResp != nil {
+				var resp FindResponse
+				json.NewDecoder(rec.Body).Decode(&resp)
+				tt.checkResp(t, resp)
+			}
+		})
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	if _, ok := fuzzyScore("xyz", "pkg/main.go"); ok {
+		t.Error("expected no match for non-subsequence")
+	}
+
+	consecutive, _ := fuzzyScore("main", "cmd/main.go")
+	scattered, _ := fuzzyScore("main", "cmd/m_a_i_n.go")
+	if consecutive <= scattered {
+		t.Errorf("consecutive score %d should beat scattered %d", consecutive, scattered)
+	}
+
+	base, _ := fuzzyScore("val", "pkg/validate.go")
+	dir, _ := fuzzyScore("val", "validate/pkg.go")
+	if base <= dir {
+		t.Errorf("basename score %d should beat directory score %d", base, dir)
+	}
+}
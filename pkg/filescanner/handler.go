@@ -2,14 +2,45 @@ package filescanner
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
+	"github.com/phillip-england/engl/pkg/fileutil"
+	"github.com/phillip-england/engl/pkg/history"
 	"github.com/phillip-england/engl/pkg/pathutil"
+	"github.com/phillip-england/engl/pkg/quota"
+	"github.com/phillip-england/engl/pkg/trash"
 )
 
+const (
+	WriteModeUpsert    = "upsert"    // create or truncate (default)
+	WriteModeCreate    = "create"    // fail if the file exists
+	WriteModeOverwrite = "overwrite" // fail if the file is missing
+	WriteModeAppend    = "append"    // append, creating the file if missing
+)
+
+var (
+	errIsDirectory    = errors.New("path is a directory, not a file")
+	errBinaryFile     = errors.New("file appears to be binary")
+	errFileExists     = errors.New("file already exists")
+	errFileNotExist   = errors.New("file does not exist")
+	errParentNotExist = errors.New("parent directory does not exist")
+	errDeleteRoot     = errors.New("refusing to delete the allowed root")
+	errDirNotEmpty    = errors.New("directory is not empty; set recursive to delete it")
+)
+
+// maxDeleteFiles caps how many files a single delete may remove
+const maxDeleteFiles = 1000
+
 type ListRequest struct {
 	Path string `json:"path"`
 }
@@ -26,32 +57,76 @@ type ListResponse struct {
 	Error string    `json:"error,omitempty"`
 }
 
+// ReadRequest reads a whole file, or with Offset or Length set, that byte
+// range of it (Length 0 reads to the end). A ranged read returns the file's
+// Size but no Hash, which always covers the whole file.
 type ReadRequest struct {
-	Path string `json:"path"`
+	Path   string `json:"path"`
+	Offset int64  `json:"offset,omitempty"`
+	Length int64  `json:"length,omitempty"`
 }
 
 type ReadResponse struct {
-	Content string `json:"content,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Content string     `json:"content,omitempty"`
+	Hash    string     `json:"hash,omitempty"`
+	Size    int64      `json:"size,omitempty"`
+	ModTime *time.Time `json:"mtime,omitempty"`
+	Error   string     `json:"error,omitempty"`
 }
 
+// WriteRequest and DeleteRequest accept the hash and/or mtime returned by a
+// previous read. When set, the mutation is rejected with a conflict if the
+// file has changed since.
+//
+// Mode selects how an existing file is treated (see the WriteMode constants),
+// Perm is an optional octal permission string such as "0755", and CreateDirs
+// controls whether missing parent directories are created (default true).
+//
+// Format runs gofmt on .go files before writing. Validate ("warn" or
+// "strict") checks Go and JSON syntax; strict refuses to write broken content.
+// Syntax errors are reported in the response either way.
 type WriteRequest struct {
-	Path    string `json:"path"`
-	Content string `json:"content"`
+	Path            string     `json:"path"`
+	Content         string     `json:"content"`
+	Mode            string     `json:"mode,omitempty"`
+	Perm            string     `json:"perm,omitempty"`
+	CreateDirs      *bool      `json:"create_dirs,omitempty"`
+	Format          bool       `json:"format,omitempty"`
+	Validate        string     `json:"validate,omitempty"`
+	ExpectedHash    string     `json:"expected_hash,omitempty"`
+	ExpectedModTime *time.Time `json:"expected_mtime,omitempty"`
 }
 
 type WriteResponse struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error,omitempty"`
+	Success      bool          `json:"success"`
+	Hash         string        `json:"hash,omitempty"`
+	ModTime      *time.Time    `json:"mtime,omitempty"`
+	Conflict     bool          `json:"conflict,omitempty"`
+	CurrentHash  string        `json:"current_hash,omitempty"`
+	SyntaxErrors []SyntaxError `json:"syntax_errors,omitempty"`
+	Error        string        `json:"error,omitempty"`
 }
 
+// DeleteRequest removes a file or directory. Non-empty directories need
+// Recursive, and DryRun reports what would be removed without removing it.
 type DeleteRequest struct {
-	Path string `json:"path"`
+	Path            string     `json:"path"`
+	Recursive       bool       `json:"recursive,omitempty"`
+	DryRun          bool       `json:"dry_run,omitempty"`
+	ExpectedHash    string     `json:"expected_hash,omitempty"`
+	ExpectedModTime *time.Time `json:"expected_mtime,omitempty"`
 }
 
+// DeleteResponse carries the trash item ID when the delete was soft, so the
+// caller can restore it with the trash tools
 type DeleteResponse struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error,omitempty"`
+	Success     bool     `json:"success"`
+	TrashID     string   `json:"trash_id,omitempty"`
+	Files       []string `json:"files,omitempty"`
+	TotalSize   int64    `json:"total_size,omitempty"`
+	Conflict    bool     `json:"conflict,omitempty"`
+	CurrentHash string   `json:"current_hash,omitempty"`
+	Error       string   `json:"error,omitempty"`
 }
 
 func ListHandler(w http.ResponseWriter, r *http.Request) {
@@ -160,14 +235,56 @@ func ReadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Offset < 0 || req.Length < 0 {
+		writeReadError(w, "offset and length must not be negative")
+		return
+	}
+	if req.Offset > 0 || req.Length > 0 {
+		content, err := readRange(validPath, req.Offset, req.Length)
+		if err != nil {
+			writeReadError(w, err.Error())
+			return
+		}
+		modTime := info.ModTime()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ReadResponse{
+			Content: string(content),
+			Size:    info.Size(),
+			ModTime: &modTime,
+		})
+		return
+	}
+
 	content, err := os.ReadFile(validPath)
 	if err != nil {
 		writeReadError(w, err.Error())
 		return
 	}
 
+	modTime := info.ModTime()
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(ReadResponse{Content: string(content)})
+	json.NewEncoder(w).Encode(ReadResponse{
+		Content: string(content),
+		Hash:    fileutil.Hash(content),
+		ModTime: &modTime,
+	})
+}
+
+// readRange reads up to length bytes of path from offset, or everything
+// after offset when length is 0
+func readRange(path string, offset, length int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = io.NewSectionReader(f, offset, math.MaxInt64-offset)
+	if length > 0 {
+		r = io.LimitReader(r, length)
+	}
+	return io.ReadAll(r)
 }
 
 func WriteHandler(w http.ResponseWriter, r *http.Request) {
@@ -188,7 +305,7 @@ func WriteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	validPath, err := pathutil.ValidatePath(req.Path)
+	validPath, err := pathutil.ValidateWritePath(req.Path)
 	if err != nil {
 		writeWriteError(w, "access denied: "+err.Error())
 		return
@@ -196,19 +313,146 @@ func WriteHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("HIT: %s | Path: %s", r.URL.Path, validPath)
 
-	dir := filepath.Dir(validPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	unlock := fileutil.LockPath(validPath)
+	defer unlock()
+
+	if current, err := fileutil.CheckVersion(validPath, req.ExpectedHash, req.ExpectedModTime); err != nil {
+		if errors.Is(err, fileutil.ErrConflict) {
+			writeWriteConflict(w, current)
+			return
+		}
 		writeWriteError(w, err.Error())
 		return
 	}
 
-	if err := os.WriteFile(validPath, []byte(req.Content), 0644); err != nil {
+	content, syntaxErrs, err := applyWrite(validPath, req)
+	if err != nil {
+		if errors.Is(err, errSyntax) {
+			writeWriteSyntaxError(w, syntaxErrs)
+			return
+		}
 		writeWriteError(w, err.Error())
 		return
 	}
 
+	resp := WriteResponse{Success: true, Hash: fileutil.Hash(content), SyntaxErrors: syntaxErrs}
+	if info, err := os.Stat(validPath); err == nil {
+		modTime := info.ModTime()
+		resp.ModTime = &modTime
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(WriteResponse{Success: true})
+	json.NewEncoder(w).Encode(resp)
+}
+
+// applyWrite writes req.Content to path according to req.Mode, Perm and
+// CreateDirs, returning the file's full content after the write and any
+// syntax errors found in it
+func applyWrite(path string, req WriteRequest) ([]byte, []SyntaxError, error) {
+	perm := os.FileMode(0644)
+	if req.Perm != "" {
+		p, err := parsePerm(req.Perm)
+		if err != nil {
+			return nil, nil, err
+		}
+		perm = p
+	}
+
+	info, err := os.Stat(path)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	if exists && info.IsDir() {
+		return nil, nil, errIsDirectory
+	}
+
+	var existing []byte
+	if exists && req.Mode == WriteModeAppend {
+		if existing, err = os.ReadFile(path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	content, err := resolveWriteMode(req.Mode, exists, existing, []byte(req.Content))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, syntaxErrs, err := checkContent(path, content, req.Format, req.Validate)
+	if err != nil {
+		return nil, syntaxErrs, err
+	}
+
+	charge, err := quota.Check(quota.Change{Path: path, Size: int64(len(content)), Partial: len(existing) > 0})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer charge.Release()
+
+	if !exists {
+		dir := filepath.Dir(path)
+		if req.CreateDirs == nil || *req.CreateDirs {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, nil, err
+			}
+		} else if _, err := os.Stat(dir); err != nil {
+			return nil, nil, errParentNotExist
+		}
+	}
+
+	if exists {
+		if err := history.Snapshot(path, "write"); err != nil {
+			return nil, nil, errors.New("history snapshot failed: " + err.Error())
+		}
+	}
+
+	if err := fileutil.WriteFile(path, content, perm); err != nil {
+		return nil, nil, err
+	}
+	charge.Commit()
+
+	// WriteFile keeps an existing file's mode; an explicit perm overrides it
+	if exists && req.Perm != "" {
+		if err := os.Chmod(path, perm); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return content, syntaxErrs, nil
+}
+
+// resolveWriteMode checks a write mode against whether the target exists and
+// returns the content the file should hold afterwards. existing is only used
+// by append.
+func resolveWriteMode(mode string, exists bool, existing, content []byte) ([]byte, error) {
+	switch mode {
+	case "", WriteModeUpsert:
+	case WriteModeCreate:
+		if exists {
+			return nil, errFileExists
+		}
+	case WriteModeOverwrite:
+		if !exists {
+			return nil, errFileNotExist
+		}
+	case WriteModeAppend:
+		if exists {
+			return append(append([]byte(nil), existing...), content...), nil
+		}
+	default:
+		return nil, errors.New("invalid mode: " + mode)
+	}
+	return content, nil
+}
+
+// parsePerm parses an octal permission string such as "0755"
+func parsePerm(s string) (os.FileMode, error) {
+	p, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || p > 0777 {
+		return 0, errors.New("invalid perm: " + s)
+	}
+	return os.FileMode(p), nil
 }
 
 func writeError(w http.ResponseWriter, msg string) {
@@ -229,6 +473,22 @@ func writeWriteError(w http.ResponseWriter, msg string) {
 	json.NewEncoder(w).Encode(WriteResponse{Error: msg})
 }
 
+func writeWriteSyntaxError(w http.ResponseWriter, errs []SyntaxError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(WriteResponse{Error: errSyntax.Error(), SyntaxErrors: errs})
+}
+
+func writeWriteConflict(w http.ResponseWriter, currentHash string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(WriteResponse{
+		Conflict:    true,
+		CurrentHash: currentHash,
+		Error:       fileutil.ErrConflict.Error(),
+	})
+}
+
 func DeleteHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -252,21 +512,148 @@ func DeleteHandler(w http.ResponseWriter, r *http.Request) {
 		writeDeleteError(w, "access denied: "+err.Error())
 		return
 	}
+	if isAllowedRoot(validPath) {
+		writeDeleteError(w, errDeleteRoot.Error())
+		return
+	}
+	if pathutil.OverlapsStateDir(validPath) {
+		writeDeleteError(w, "access denied: "+pathutil.ErrStateDir.Error())
+		return
+	}
 
 	log.Printf("HIT: %s | Path: %s", r.URL.Path, validPath)
 
-	if _, err := os.Stat(validPath); err != nil {
+	unlock := fileutil.LockPath(validPath)
+	defer unlock()
+
+	info, err := os.Stat(validPath)
+	if err != nil {
+		writeDeleteError(w, err.Error())
+		return
+	}
+
+	if current, err := fileutil.CheckVersion(validPath, req.ExpectedHash, req.ExpectedModTime); err != nil {
+		if errors.Is(err, fileutil.ErrConflict) {
+			writeDeleteConflict(w, current)
+			return
+		}
+		writeDeleteError(w, err.Error())
+		return
+	}
+
+	files, size, err := treeFiles(validPath)
+	if err != nil {
 		writeDeleteError(w, err.Error())
 		return
 	}
 
-	if err := os.RemoveAll(validPath); err != nil {
+	if info.IsDir() && !req.Recursive {
+		if entries, err := os.ReadDir(validPath); err != nil || len(entries) > 0 {
+			writeDeleteError(w, errDirNotEmpty.Error())
+			return
+		}
+	}
+
+	if len(files) > maxDeleteFiles {
+		writeDeleteError(w, fmt.Sprintf("delete would remove %d files, more than the limit of %d", len(files), maxDeleteFiles))
+		return
+	}
+
+	if req.DryRun {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DeleteResponse{Success: true, Files: files, TotalSize: size})
+		return
+	}
+
+	if err := history.Snapshot(validPath, "delete"); err != nil {
+		writeDeleteError(w, "history snapshot failed: "+err.Error())
+		return
+	}
+
+	trashID, err := discard(validPath, r.RemoteAddr)
+	if err != nil {
 		writeDeleteError(w, err.Error())
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(DeleteResponse{Success: true})
+	json.NewEncoder(w).Encode(DeleteResponse{Success: true, TrashID: trashID})
+}
+
+// applyChanges applies a changeset, sending the files it deletes to the
+// trash unless hard delete is on. It returns the trash item ID of each
+// deleted path.
+func applyChanges(changes []fileutil.Change, caller string) (map[string]string, error) {
+	if trash.HardDelete() {
+		return nil, fileutil.Apply(changes)
+	}
+
+	trashed := map[string]string{}
+	for i := range changes {
+		if changes[i].Delete {
+			changes[i].Remove = func(path string) error {
+				item, err := trash.Move(path, caller)
+				if err == nil {
+					trashed[path] = item.ID
+				}
+				return err
+			}
+		}
+	}
+
+	if err := fileutil.Apply(changes); err != nil {
+		// The rollback put the deleted files back, so their trash items go
+		for _, id := range trashed {
+			trash.Purge(id, time.Time{})
+		}
+		return nil, err
+	}
+	return trashed, nil
+}
+
+// discard moves path to the trash and returns the item's ID, or removes it
+// for good when hard delete is on
+func discard(path, caller string) (string, error) {
+	defer quota.Invalidate()
+	if trash.HardDelete() {
+		return "", os.RemoveAll(path)
+	}
+	item, err := trash.Move(path, caller)
+	return item.ID, err
+}
+
+// isAllowedRoot reports whether path is the allowed root itself
+func isAllowedRoot(path string) bool {
+	root := pathutil.GetAllowedRoot()
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	return filepath.Clean(path) == filepath.Clean(root)
+}
+
+// treeFiles lists the files and symlinks at or under path, with the total
+// size of the regular files among them. Symlinks are not followed.
+func treeFiles(path string) ([]string, int64, error) {
+	files := []string{}
+	var size int64
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		files = append(files, p)
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return files, size, err
 }
 
 func writeDeleteError(w http.ResponseWriter, msg string) {
@@ -274,3 +661,13 @@ func writeDeleteError(w http.ResponseWriter, msg string) {
 	w.WriteHeader(http.StatusBadRequest)
 	json.NewEncoder(w).Encode(DeleteResponse{Error: msg})
 }
+
+func writeDeleteConflict(w http.ResponseWriter, currentHash string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(DeleteResponse{
+		Conflict:    true,
+		CurrentHash: currentHash,
+		Error:       fileutil.ErrConflict.Error(),
+	})
+}
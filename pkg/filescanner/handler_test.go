@@ -7,9 +7,15 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/phillip-england/engl/pkg/history"
 	"github.com/phillip-england/engl/pkg/pathutil"
+	"github.com/phillip-england/engl/pkg/quota"
+	"github.com/phillip-england/engl/pkg/trash"
 )
 
 func withAllowedRoot(t *testing.T, root string) func() {
@@ -141,6 +147,50 @@ func TestReadHandler(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:       "byte range",
+			method:     http.MethodPost,
+			body:       ReadRequest{Path: testFile, Offset: 6, Length: 3},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp ReadResponse) {
+				if resp.Content != "wor" || resp.Size != 11 || resp.Hash != "" {
+					t.Errorf("got content %q size %d hash %q", resp.Content, resp.Size, resp.Hash)
+				}
+			},
+		},
+		{
+			name:       "offset to end",
+			method:     http.MethodPost,
+			body:       ReadRequest{Path: testFile, Offset: 6},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp ReadResponse) {
+				if resp.Content != "world" {
+					t.Errorf("got content %q, want %q", resp.Content, "world")
+				}
+			},
+		},
+		{
+			name:       "offset past end",
+			method:     http.MethodPost,
+			body:       ReadRequest{Path: testFile, Offset: 100, Length: 5},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp ReadResponse) {
+				if resp.Content != "" || resp.Size != 11 {
+					t.Errorf("got content %q size %d", resp.Content, resp.Size)
+				}
+			},
+		},
+		{
+			name:       "negative offset",
+			method:     http.MethodPost,
+			body:       ReadRequest{Path: testFile, Offset: -1},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp ReadResponse) {
+				if resp.Error != "offset and length must not be negative" {
+					t.Errorf("got error %q", resp.Error)
+				}
+			},
+		},
 		{
 			name:       "missing path",
 			method:     http.MethodPost,
@@ -212,6 +262,10 @@ func TestWriteHandler(t *testing.T) {
 	tmpDir := t.TempDir()
 	defer withAllowedRoot(t, tmpDir)()
 
+	existing := filepath.Join(tmpDir, "existing.txt")
+	os.WriteFile(existing, []byte("line1\n"), 0644)
+	noDirs := false
+
 	tests := []struct {
 		name       string
 		method     string
@@ -263,6 +317,92 @@ func TestWriteHandler(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:       "create mode fails when file exists",
+			method:     http.MethodPost,
+			body:       WriteRequest{Path: existing, Content: "x", Mode: WriteModeCreate},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp WriteResponse) {
+				if resp.Error != "file already exists" {
+					t.Errorf("got error %q, want %q", resp.Error, "file already exists")
+				}
+			},
+		},
+		{
+			name:       "overwrite mode fails when file is missing",
+			method:     http.MethodPost,
+			body:       WriteRequest{Path: filepath.Join(tmpDir, "missing.txt"), Content: "x", Mode: WriteModeOverwrite},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp WriteResponse) {
+				if resp.Error != "file does not exist" {
+					t.Errorf("got error %q, want %q", resp.Error, "file does not exist")
+				}
+			},
+			verifyFile: func(t *testing.T) {
+				if _, err := os.Stat(filepath.Join(tmpDir, "missing.txt")); !os.IsNotExist(err) {
+					t.Error("file should not have been created")
+				}
+			},
+		},
+		{
+			name:       "append mode",
+			method:     http.MethodPost,
+			body:       WriteRequest{Path: existing, Content: "line2\n", Mode: WriteModeAppend},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp WriteResponse) {
+				if !resp.Success {
+					t.Errorf("expected success, got error %q", resp.Error)
+				}
+			},
+			verifyFile: func(t *testing.T) {
+				content, _ := os.ReadFile(existing)
+				if string(content) != "line1\nline2\n" {
+					t.Errorf("got content %q, want %q", string(content), "line1\nline2\n")
+				}
+			},
+		},
+		{
+			name:       "explicit perm",
+			method:     http.MethodPost,
+			body:       WriteRequest{Path: existing, Content: "#!/bin/sh\n", Mode: WriteModeOverwrite, Perm: "0750"},
+			wantStatus: http.StatusOK,
+			checkResp:  nil,
+			verifyFile: func(t *testing.T) {
+				info, _ := os.Stat(existing)
+				if info.Mode().Perm() != 0750 {
+					t.Errorf("got mode %v, want 0750", info.Mode().Perm())
+				}
+			},
+		},
+		{
+			name:       "invalid perm",
+			method:     http.MethodPost,
+			body:       WriteRequest{Path: existing, Content: "x", Perm: "4755"},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp WriteResponse) {
+				if resp.Error != "invalid perm: 4755" {
+					t.Errorf("got error %q, want %q", resp.Error, "invalid perm: 4755")
+				}
+			},
+		},
+		{
+			name:       "create_dirs false",
+			method:     http.MethodPost,
+			body:       WriteRequest{Path: filepath.Join(tmpDir, "nodir", "file.txt"), Content: "x", CreateDirs: &noDirs},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp WriteResponse) {
+				if resp.Error != "parent directory does not exist" {
+					t.Errorf("got error %q, want %q", resp.Error, "parent directory does not exist")
+				}
+			},
+		},
+		{
+			name:       "invalid mode",
+			method:     http.MethodPost,
+			body:       WriteRequest{Path: existing, Content: "x", Mode: "truncate"},
+			wantStatus: http.StatusBadRequest,
+			checkResp:  nil,
+		},
 		{
 			name:       "missing path",
 			method:     http.MethodPost,
@@ -340,6 +480,32 @@ func TestDeleteHandler(t *testing.T) {
 				if !resp.Success {
 					t.Error("expected success to be true")
 				}
+				if resp.TrashID == "" {
+					t.Error("expected a trash id for a soft delete")
+				}
+			},
+			verifyDel: func(t *testing.T, path string) {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Error("file should have been deleted")
+				}
+			},
+		},
+		{
+			name:   "hard delete",
+			method: http.MethodPost,
+			setup: func(t *testing.T) string {
+				trash.SetHardDelete(true)
+				t.Cleanup(func() { trash.SetHardDelete(false) })
+				path := filepath.Join(tmpDir, "hard.txt")
+				os.WriteFile(path, []byte("gone"), 0644)
+				return path
+			},
+			body:       func(path string) any { return DeleteRequest{Path: path} },
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp DeleteResponse) {
+				if !resp.Success || resp.TrashID != "" {
+					t.Errorf("got %+v, want success without a trash id", resp)
+				}
 			},
 			verifyDel: func(t *testing.T, path string) {
 				if _, err := os.Stat(path); !os.IsNotExist(err) {
@@ -356,7 +522,7 @@ func TestDeleteHandler(t *testing.T) {
 				os.WriteFile(filepath.Join(dir, "file.txt"), []byte("content"), 0644)
 				return dir
 			},
-			body:       func(path string) any { return DeleteRequest{Path: path} },
+			body:       func(path string) any { return DeleteRequest{Path: path, Recursive: true} },
 			wantStatus: http.StatusOK,
 			checkResp: func(t *testing.T, resp DeleteResponse) {
 				if !resp.Success {
@@ -369,6 +535,106 @@ func TestDeleteHandler(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:   "non-empty directory without recursive",
+			method: http.MethodPost,
+			setup: func(t *testing.T) string {
+				dir := filepath.Join(tmpDir, "keep")
+				os.Mkdir(dir, 0755)
+				os.WriteFile(filepath.Join(dir, "file.txt"), []byte("content"), 0644)
+				return dir
+			},
+			body:       func(path string) any { return DeleteRequest{Path: path} },
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp DeleteResponse) {
+				if resp.Error != errDirNotEmpty.Error() {
+					t.Errorf("got error %q, want %q", resp.Error, errDirNotEmpty.Error())
+				}
+			},
+			verifyDel: func(t *testing.T, path string) {
+				if _, err := os.Stat(filepath.Join(path, "file.txt")); err != nil {
+					t.Error("directory contents should be untouched")
+				}
+			},
+		},
+		{
+			name:   "empty directory without recursive",
+			method: http.MethodPost,
+			setup: func(t *testing.T) string {
+				dir := filepath.Join(tmpDir, "empty")
+				os.Mkdir(dir, 0755)
+				return dir
+			},
+			body:       func(path string) any { return DeleteRequest{Path: path} },
+			wantStatus: http.StatusOK,
+			verifyDel: func(t *testing.T, path string) {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Error("directory should have been deleted")
+				}
+			},
+		},
+		{
+			name:   "dry run",
+			method: http.MethodPost,
+			setup: func(t *testing.T) string {
+				dir := filepath.Join(tmpDir, "preview")
+				os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+				os.WriteFile(filepath.Join(dir, "a.txt"), []byte("abc"), 0644)
+				os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("de"), 0644)
+				return dir
+			},
+			body:       func(path string) any { return DeleteRequest{Path: path, Recursive: true, DryRun: true} },
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp DeleteResponse) {
+				want := []string{filepath.Join(tmpDir, "preview", "a.txt"), filepath.Join(tmpDir, "preview", "sub", "b.txt")}
+				if strings.Join(resp.Files, ",") != strings.Join(want, ",") {
+					t.Errorf("got files %v, want %v", resp.Files, want)
+				}
+				if resp.TotalSize != 5 {
+					t.Errorf("got total size %d, want 5", resp.TotalSize)
+				}
+				if resp.TrashID != "" {
+					t.Error("dry run should not move anything to the trash")
+				}
+			},
+			verifyDel: func(t *testing.T, path string) {
+				if _, err := os.Stat(filepath.Join(path, "sub", "b.txt")); err != nil {
+					t.Error("dry run should not delete anything")
+				}
+			},
+		},
+		{
+			name:   "too many files",
+			method: http.MethodPost,
+			setup: func(t *testing.T) string {
+				dir := filepath.Join(tmpDir, "many")
+				os.Mkdir(dir, 0755)
+				for i := range maxDeleteFiles + 1 {
+					os.WriteFile(filepath.Join(dir, strconv.Itoa(i)), nil, 0644)
+				}
+				return dir
+			},
+			body:       func(path string) any { return DeleteRequest{Path: path, Recursive: true} },
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp DeleteResponse) {
+				want := "delete would remove 1001 files, more than the limit of 1000"
+				if resp.Error != want {
+					t.Errorf("got error %q, want %q", resp.Error, want)
+				}
+			},
+		},
+		{
+			name:       "allowed root",
+			method:     http.MethodPost,
+			setup:      func(t *testing.T) string { return tmpDir },
+			body:       func(path string) any { return DeleteRequest{Path: path, Recursive: true} },
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp DeleteResponse) {
+				if resp.Error != errDeleteRoot.Error() {
+					t.Errorf("got error %q, want %q", resp.Error, errDeleteRoot.Error())
+				}
+			},
+		},
 		{
 			name:       "missing path",
 			method:     http.MethodPost,
@@ -435,3 +701,205 @@ func TestDeleteHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestOptimisticConcurrency(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	path := filepath.Join(tmpDir, "shared.txt")
+	os.WriteFile(path, []byte("v1"), 0644)
+
+	post := func(handler http.HandlerFunc, body any, resp any) int {
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(body)
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/", &buf))
+		json.NewDecoder(rec.Body).Decode(resp)
+		return rec.Code
+	}
+
+	var read ReadResponse
+	post(ReadHandler, ReadRequest{Path: path}, &read)
+	if read.Hash == "" || read.ModTime == nil {
+		t.Fatalf("expected hash and mtime in read response, got %+v", read)
+	}
+
+	var first WriteResponse
+	if code := post(WriteHandler, WriteRequest{Path: path, Content: "v2", ExpectedHash: read.Hash}, &first); code != http.StatusOK {
+		t.Fatalf("first write: got status %d, error %q", code, first.Error)
+	}
+
+	var stale WriteResponse
+	code := post(WriteHandler, WriteRequest{Path: path, Content: "v3", ExpectedHash: read.Hash}, &stale)
+	if code != http.StatusConflict || !stale.Conflict {
+		t.Errorf("stale write: got status %d conflict=%v, want 409", code, stale.Conflict)
+	}
+	if stale.CurrentHash != first.Hash {
+		t.Errorf("got current hash %q, want %q", stale.CurrentHash, first.Hash)
+	}
+
+	var staleMtime WriteResponse
+	old := read.ModTime.Add(-time.Hour)
+	if code := post(WriteHandler, WriteRequest{Path: path, Content: "v3", ExpectedModTime: &old}, &staleMtime); code != http.StatusConflict {
+		t.Errorf("stale mtime write: got status %d, want 409", code)
+	}
+
+	content, _ := os.ReadFile(path)
+	if string(content) != "v2" {
+		t.Errorf("got content %q, want %q", content, "v2")
+	}
+
+	var staleDelete DeleteResponse
+	if code := post(DeleteHandler, DeleteRequest{Path: path, ExpectedHash: read.Hash}, &staleDelete); code != http.StatusConflict {
+		t.Errorf("stale delete: got status %d, want 409", code)
+	}
+
+	var del DeleteResponse
+	if code := post(DeleteHandler, DeleteRequest{Path: path, ExpectedHash: first.Hash, ExpectedModTime: first.ModTime}, &del); code != http.StatusOK {
+		t.Errorf("delete: got status %d, error %q", code, del.Error)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("file should have been deleted")
+	}
+}
+
+func TestMutationsRecordHistory(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	path := filepath.Join(tmpDir, "notes.txt")
+
+	post := func(handler http.HandlerFunc, body any) int {
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(body)
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/", &buf))
+		return rec.Code
+	}
+
+	steps := []struct {
+		handler http.HandlerFunc
+		body    any
+	}{
+		{WriteHandler, WriteRequest{Path: path, Content: "v1\n"}},
+		{WriteHandler, WriteRequest{Path: path, Content: "v2\n"}},
+		{EditHandler, EditRequest{Path: path, OldString: "v2", NewString: "v3"}},
+		{DeleteHandler, DeleteRequest{Path: path}},
+	}
+	for i, s := range steps {
+		if code := post(s.handler, s.body); code != http.StatusOK {
+			t.Fatalf("step %d: got status %d", i+1, code)
+		}
+	}
+
+	entries, err := history.List(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		content, _ := history.Read(e.Hash)
+		got = append(got, e.Op+":"+string(content))
+	}
+	want := []string{"delete:v3\n", "edit:v2\n", "write:v1\n"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got history %q, want %q", got, want)
+	}
+}
+
+func TestWriteQuota(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+	defer quota.SetLimits(quota.DefaultLimits)
+
+	quota.SetLimits(quota.Limits{MaxWriteBytes: 8})
+	path := filepath.Join(tmpDir, "big.txt")
+
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(WriteRequest{Path: path, Content: "123456789"})
+	rec := httptest.NewRecorder()
+	WriteHandler(rec, httptest.NewRequest(http.MethodPost, "/mcp/tool/file_scanner/write", &buf))
+
+	var resp WriteResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	want := "quota exceeded: writing 9 bytes exceeds the per-write limit of 8 bytes"
+	if rec.Code != http.StatusBadRequest || resp.Error != want {
+		t.Errorf("got status %d, error %q; want 400, %q", rec.Code, resp.Error, want)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("file should not have been written")
+	}
+
+	// Appends and edits are charged what they add, not the whole file
+	os.WriteFile(path, []byte(strings.Repeat("x", 20)), 0644)
+	post := func(handler http.HandlerFunc, body any) (int, string) {
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(body)
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/", &buf))
+		var resp struct{ Error string }
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec.Code, resp.Error
+	}
+	if code, msg := post(WriteHandler, WriteRequest{Path: path, Content: "1234", Mode: WriteModeAppend}); code != http.StatusOK {
+		t.Errorf("small append to a big file: got %d %q", code, msg)
+	}
+	if code, msg := post(EditHandler, EditRequest{Path: path, OldString: "1234", NewString: "12345"}); code != http.StatusOK {
+		t.Errorf("small edit to a big file: got %d %q", code, msg)
+	}
+	want = "quota exceeded: writing 9 bytes exceeds the per-write limit of 8 bytes"
+	if _, msg := post(WriteHandler, WriteRequest{Path: path, Content: "123456789", Mode: WriteModeAppend}); msg != want {
+		t.Errorf("large append: got error %q, want %q", msg, want)
+	}
+}
+
+func TestStateDirProtected(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	// Put something in history and the trash so the state directory exists
+	os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a"), 0644)
+	history.Snapshot(filepath.Join(tmpDir, "a.txt"), "write")
+	state := filepath.Join(tmpDir, pathutil.StateDirName)
+	target := filepath.Join(state, "history", "forged")
+	os.WriteFile(filepath.Join(tmpDir, "b.txt"), []byte("b"), 0644)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    any
+	}{
+		{"write", WriteHandler, WriteRequest{Path: target, Content: "x"}},
+		{"write relative", WriteHandler, WriteRequest{Path: ".engl/trash/x", Content: "x"}},
+		{"edit", EditHandler, EditRequest{Path: target, OldString: "a", NewString: "b"}},
+		{"edit_lines", EditLinesHandler, EditLinesRequest{Path: target, Operation: LineOpInsert, StartLine: 1, Content: "x"}},
+		{"delete", DeleteHandler, DeleteRequest{Path: state, Recursive: true}},
+		{"move into", MoveHandler, MoveRequest{Source: filepath.Join(tmpDir, "b.txt"), Destination: target}},
+		{"move out", MoveHandler, MoveRequest{Source: state, Destination: filepath.Join(tmpDir, "stolen")}},
+		{"copy into", CopyHandler, MoveRequest{Source: filepath.Join(tmpDir, "b.txt"), Destination: target}},
+		{"transaction", TransactionHandler, TransactionRequest{Operations: []TransactionOp{{Op: TxOpWrite, Path: target, Content: "x"}}}},
+		{"patch", PatchHandler, PatchRequest{Patch: "--- /dev/null\n+++ .engl/history/forged\n@@ -0,0 +1 @@\n+x\n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			json.NewEncoder(&buf).Encode(tt.body)
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest(http.MethodPost, "/", &buf))
+			if rec.Code == http.StatusOK {
+				t.Fatalf("got status 200, want the state directory to be refused")
+			}
+			if !strings.Contains(rec.Body.String(), pathutil.ErrStateDir.Error()) {
+				t.Errorf("got %s", rec.Body)
+			}
+		})
+	}
+
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("forged file exists: %v", err)
+	}
+	if _, err := os.Stat(state); err != nil {
+		t.Errorf("state directory was removed: %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+package filescanner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/phillip-england/engl/pkg/fileutil"
+	"github.com/phillip-england/engl/pkg/history"
+	"github.com/phillip-england/engl/pkg/pathutil"
+	"github.com/phillip-england/engl/pkg/quota"
+	"github.com/phillip-england/engl/pkg/trash"
+)
+
+const (
+	OverwriteError   = "error"   // fail if the destination exists (default)
+	OverwriteReplace = "replace" // delete the destination first, as the delete tool would
+	OverwriteSkip    = "skip"    // leave the destination alone and report it
+)
+
+var (
+	errDestinationExists = errors.New("destination already exists")
+	errSameSourceDest    = errors.New("source and destination are the same")
+	errDestInsideSource  = errors.New("destination is inside source")
+	errSourceInsideDest  = errors.New("source is inside destination")
+)
+
+// MoveRequest is shared by the move and copy tools. Destination is the full
+// target path, not a directory to move into; Overwrite selects what happens
+// when it exists (see the Overwrite constants).
+type MoveRequest struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Overwrite   string `json:"overwrite,omitempty"`
+}
+
+// MoveResponse carries the trash item ID of a replaced destination, so the
+// caller can restore it with the trash tools
+type MoveResponse struct {
+	Success     bool   `json:"success"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	Skipped     bool   `json:"skipped,omitempty"`
+	TrashID     string `json:"trash_id,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// MoveHandler moves or renames a file or directory. It renames in place when
+// it can and falls back to copy and remove across filesystems.
+func MoveHandler(w http.ResponseWriter, r *http.Request) {
+	handleTransfer(w, r, false)
+}
+
+// CopyHandler copies a file or directory, recursively for directories
+func CopyHandler(w http.ResponseWriter, r *http.Request) {
+	handleTransfer(w, r, true)
+}
+
+func handleTransfer(w http.ResponseWriter, r *http.Request, isCopy bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeMoveError(w, "Invalid JSON body")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Source == "" || req.Destination == "" {
+		writeMoveError(w, "source and destination are required")
+		return
+	}
+
+	switch req.Overwrite {
+	case "", OverwriteError, OverwriteReplace, OverwriteSkip:
+	default:
+		writeMoveError(w, "invalid overwrite: "+req.Overwrite)
+		return
+	}
+
+	validateSource := pathutil.ValidateWritePath
+	if isCopy {
+		validateSource = pathutil.ValidatePath
+	}
+	src, err := validateSource(req.Source)
+	if err != nil {
+		writeMoveError(w, "access denied: "+err.Error())
+		return
+	}
+	dst, err := pathutil.ValidateWritePath(req.Destination)
+	if err != nil {
+		writeMoveError(w, "access denied: "+err.Error())
+		return
+	}
+
+	log.Printf("HIT: %s | Source: %s | Destination: %s", r.URL.Path, src, dst)
+
+	unlock := fileutil.LockPaths([]string{src, dst})
+	defer unlock()
+
+	resp := MoveResponse{Source: src, Destination: dst}
+
+	if _, err := os.Stat(src); err != nil {
+		writeMoveError(w, err.Error())
+		return
+	}
+	if !isCopy && isAllowedRoot(src) {
+		writeMoveError(w, "refusing to move the allowed root")
+		return
+	}
+	if src == dst {
+		writeMoveError(w, errSameSourceDest.Error())
+		return
+	}
+	if rel, err := filepath.Rel(src, dst); err == nil && filepath.IsLocal(rel) {
+		writeMoveError(w, errDestInsideSource.Error())
+		return
+	}
+	if rel, err := filepath.Rel(dst, src); err == nil && filepath.IsLocal(rel) {
+		writeMoveError(w, errSourceInsideDest.Error())
+		return
+	}
+
+	// A copy is charged against the quota before anything is replaced
+	var charge *quota.Charge
+	if isCopy {
+		_, size, err := treeFiles(src)
+		if err != nil {
+			writeMoveError(w, err.Error())
+			return
+		}
+		if charge, err = quota.Check(quota.Change{Path: dst, Size: size}); err != nil {
+			writeMoveError(w, err.Error())
+			return
+		}
+		defer charge.Release()
+	}
+
+	_, statErr := os.Lstat(dst)
+	replace := statErr == nil
+	if replace {
+		switch req.Overwrite {
+		case OverwriteSkip:
+			resp.Success, resp.Skipped = true, true
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+			return
+		case OverwriteReplace:
+			if isAllowedRoot(dst) {
+				writeMoveError(w, errDeleteRoot.Error())
+				return
+			}
+			files, _, err := treeFiles(dst)
+			if err != nil {
+				writeMoveError(w, err.Error())
+				return
+			}
+			if len(files) > maxDeleteFiles {
+				writeMoveError(w, fmt.Sprintf("replace would remove %d files, more than the limit of %d", len(files), maxDeleteFiles))
+				return
+			}
+		default:
+			writeMoveError(w, errDestinationExists.Error())
+			return
+		}
+	}
+
+	// Everything that can fail without side effects happens before the
+	// destination is replaced
+	if !isCopy {
+		if err := history.Snapshot(src, "move"); err != nil {
+			writeMoveError(w, "history snapshot failed: "+err.Error())
+			return
+		}
+	}
+	if replace {
+		if err := history.Snapshot(dst, "overwrite"); err != nil {
+			writeMoveError(w, "history snapshot failed: "+err.Error())
+			return
+		}
+		if resp.TrashID, err = discard(dst, r.RemoteAddr); err != nil {
+			writeMoveError(w, err.Error())
+			return
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		writeReplacedError(w, err.Error(), dst, resp.TrashID)
+		return
+	}
+
+	if isCopy {
+		if err := fileutil.CopyTree(src, dst); err != nil {
+			writeReplacedError(w, err.Error(), dst, resp.TrashID)
+			return
+		}
+		charge.Commit()
+	} else {
+		if err := fileutil.Move(src, dst); err != nil {
+			writeReplacedError(w, err.Error(), dst, resp.TrashID)
+			return
+		}
+	}
+
+	resp.Success = true
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func writeMoveError(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(MoveResponse{Error: msg})
+}
+
+// writeReplacedError reports a move or copy that failed after its
+// destination went to the trash. The destination is put back when it can;
+// otherwise the response carries its trash ID.
+func writeReplacedError(w http.ResponseWriter, msg, dst, trashID string) {
+	if trashID != "" {
+		if _, err := trash.Restore(trashID, dst); err == nil {
+			trashID = ""
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(MoveResponse{TrashID: trashID, Error: msg})
+}
@@ -0,0 +1,292 @@
+package filescanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/phillip-england/engl/pkg/trash"
+)
+
+func TestMoveHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	write := func(rel, content string) string {
+		path := filepath.Join(tmpDir, rel)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+		return path
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		setup      func() MoveRequest
+		wantStatus int
+		checkResp  func(*testing.T, MoveResponse)
+		verify     func(*testing.T)
+	}{
+		{
+			name:   "rename file",
+			method: http.MethodPost,
+			setup: func() MoveRequest {
+				write("old.txt", "hello")
+				return MoveRequest{Source: "old.txt", Destination: "new/name.txt"}
+			},
+			wantStatus: http.StatusOK,
+			verify: func(t *testing.T) {
+				if _, err := os.Stat(filepath.Join(tmpDir, "old.txt")); !os.IsNotExist(err) {
+					t.Error("source should be gone")
+				}
+				if got, _ := os.ReadFile(filepath.Join(tmpDir, "new", "name.txt")); string(got) != "hello" {
+					t.Errorf("got content %q, want %q", got, "hello")
+				}
+			},
+		},
+		{
+			name:   "move directory",
+			method: http.MethodPost,
+			setup: func() MoveRequest {
+				write("src/a/b.txt", "b")
+				return MoveRequest{Source: "src", Destination: "dst"}
+			},
+			wantStatus: http.StatusOK,
+			verify: func(t *testing.T) {
+				if got, _ := os.ReadFile(filepath.Join(tmpDir, "dst", "a", "b.txt")); string(got) != "b" {
+					t.Errorf("got content %q, want %q", got, "b")
+				}
+			},
+		},
+		{
+			name:   "destination exists",
+			method: http.MethodPost,
+			setup: func() MoveRequest {
+				write("x.txt", "x")
+				write("y.txt", "y")
+				return MoveRequest{Source: "x.txt", Destination: "y.txt"}
+			},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp MoveResponse) {
+				if resp.Error != errDestinationExists.Error() {
+					t.Errorf("got error %q, want %q", resp.Error, errDestinationExists.Error())
+				}
+			},
+		},
+		{
+			name:   "skip existing",
+			method: http.MethodPost,
+			setup: func() MoveRequest {
+				write("x.txt", "x")
+				write("y.txt", "y")
+				return MoveRequest{Source: "x.txt", Destination: "y.txt", Overwrite: OverwriteSkip}
+			},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp MoveResponse) {
+				if !resp.Skipped {
+					t.Error("expected skipped to be true")
+				}
+			},
+			verify: func(t *testing.T) {
+				if got, _ := os.ReadFile(filepath.Join(tmpDir, "y.txt")); string(got) != "y" {
+					t.Errorf("got content %q, want %q", got, "y")
+				}
+			},
+		},
+		{
+			name:   "replace existing",
+			method: http.MethodPost,
+			setup: func() MoveRequest {
+				write("x.txt", "x")
+				write("y.txt", "y")
+				return MoveRequest{Source: "x.txt", Destination: "y.txt", Overwrite: OverwriteReplace}
+			},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp MoveResponse) {
+				item, err := trash.Lookup(resp.TrashID)
+				if err != nil {
+					t.Fatalf("replaced destination should be in the trash: %v", err)
+				}
+				if item.OriginalPath != "y.txt" {
+					t.Errorf("got trashed path %q, want %q", item.OriginalPath, "y.txt")
+				}
+			},
+			verify: func(t *testing.T) {
+				if got, _ := os.ReadFile(filepath.Join(tmpDir, "y.txt")); string(got) != "x" {
+					t.Errorf("got content %q, want %q", got, "x")
+				}
+			},
+		},
+		{
+			name:   "replace too many files",
+			method: http.MethodPost,
+			setup: func() MoveRequest {
+				write("few.txt", "f")
+				for i := range maxDeleteFiles + 1 {
+					write(fmt.Sprintf("many/%d.txt", i), "m")
+				}
+				return MoveRequest{Source: "few.txt", Destination: "many", Overwrite: OverwriteReplace}
+			},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp MoveResponse) {
+				want := fmt.Sprintf("replace would remove %d files, more than the limit of %d", maxDeleteFiles+1, maxDeleteFiles)
+				if resp.Error != want {
+					t.Errorf("got error %q, want %q", resp.Error, want)
+				}
+			},
+			verify: func(t *testing.T) {
+				if _, err := os.Stat(filepath.Join(tmpDir, "many", "0.txt")); err != nil {
+					t.Error("destination should be untouched")
+				}
+			},
+		},
+		{
+			name:   "into itself",
+			method: http.MethodPost,
+			setup: func() MoveRequest {
+				write("tree/f.txt", "f")
+				return MoveRequest{Source: "tree", Destination: "tree/inner"}
+			},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp MoveResponse) {
+				if resp.Error != errDestInsideSource.Error() {
+					t.Errorf("got error %q, want %q", resp.Error, errDestInsideSource.Error())
+				}
+			},
+		},
+		{
+			name:   "replace parent of source",
+			method: http.MethodPost,
+			setup: func() MoveRequest {
+				write("outer/f.txt", "f")
+				return MoveRequest{Source: "outer/f.txt", Destination: "outer", Overwrite: OverwriteReplace}
+			},
+			wantStatus: http.StatusBadRequest,
+			verify: func(t *testing.T) {
+				if _, err := os.Stat(filepath.Join(tmpDir, "outer", "f.txt")); err != nil {
+					t.Error("source should be untouched")
+				}
+			},
+		},
+		{
+			name:   "outside root",
+			method: http.MethodPost,
+			setup: func() MoveRequest {
+				write("z.txt", "z")
+				return MoveRequest{Source: "z.txt", Destination: "/etc/z.txt"}
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid overwrite",
+			method:     http.MethodPost,
+			setup:      func() MoveRequest { return MoveRequest{Source: "a", Destination: "b", Overwrite: "maybe"} },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodGet,
+			setup:      func() MoveRequest { return MoveRequest{} },
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.setup())
+			req := httptest.NewRequest(tt.method, "/mcp/tool/file_scanner/move", bytes.NewReader(body))
+			rec := httptest.NewRecorder()
+
+			MoveHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d (%s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.checkResp != nil {
+				var resp MoveResponse
+				json.NewDecoder(rec.Body).Decode(&resp)
+				tt.checkResp(t, resp)
+			}
+			if tt.verify != nil {
+				tt.verify(t)
+			}
+		})
+	}
+}
+
+func TestCopyHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	src := filepath.Join(tmpDir, "src")
+	os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	os.WriteFile(filepath.Join(src, "run.sh"), []byte("#!/bin/sh\n"), 0755)
+	os.WriteFile(filepath.Join(src, "sub", "a.txt"), []byte("a"), 0644)
+
+	body, _ := json.Marshal(MoveRequest{Source: "src", Destination: "copy"})
+	rec := httptest.NewRecorder()
+	CopyHandler(rec, httptest.NewRequest(http.MethodPost, "/mcp/tool/file_scanner/copy", bytes.NewReader(body)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(src, "sub", "a.txt")); err != nil {
+		t.Error("source should still exist after copy")
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmpDir, "copy", "sub", "a.txt")); string(got) != "a" {
+		t.Errorf("got content %q, want %q", got, "a")
+	}
+	if info, err := os.Stat(filepath.Join(tmpDir, "copy", "run.sh")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("copied script should keep mode 0755: %v", err)
+	}
+}
+
+func TestWriteReplacedError(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	dst := filepath.Join(tmpDir, "dst.txt")
+	trashDst := func() string {
+		os.WriteFile(dst, []byte("old"), 0644)
+		item, err := trash.Move(dst, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return item.ID
+	}
+
+	t.Run("destination restored", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		writeReplacedError(rec, "copy failed", dst, trashDst())
+
+		var resp MoveResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if rec.Code != http.StatusBadRequest || resp.Error != "copy failed" || resp.TrashID != "" {
+			t.Errorf("got status %d, response %+v", rec.Code, resp)
+		}
+		if got, _ := os.ReadFile(dst); string(got) != "old" {
+			t.Errorf("destination should be restored, got %q", got)
+		}
+	})
+
+	t.Run("destination in the way", func(t *testing.T) {
+		id := trashDst()
+		os.WriteFile(dst, []byte("partial"), 0644)
+		rec := httptest.NewRecorder()
+		writeReplacedError(rec, "move failed", dst, id)
+
+		var resp MoveResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if resp.TrashID != id {
+			t.Errorf("got trash id %q, want %q so the caller can restore it", resp.TrashID, id)
+		}
+		if _, err := trash.Lookup(id); err != nil {
+			t.Errorf("item should still be in the trash: %v", err)
+		}
+	})
+}
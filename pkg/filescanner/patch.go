@@ -0,0 +1,218 @@
+package filescanner
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/phillip-england/engl/pkg/diff"
+	"github.com/phillip-england/engl/pkg/fileutil"
+	"github.com/phillip-england/engl/pkg/pathutil"
+	"github.com/phillip-england/engl/pkg/quota"
+)
+
+var errPatchRejected = errors.New("patch does not apply; no files were changed")
+
+type PatchRequest struct {
+	Patch  string `json:"patch"`
+	Fuzz   int    `json:"fuzz"`
+	DryRun bool   `json:"dry_run"`
+}
+
+type PatchFileResult struct {
+	Path    string            `json:"path"`
+	OldPath string            `json:"old_path,omitempty"`
+	Action  string            `json:"action"`
+	Hunks   []diff.HunkResult `json:"hunks,omitempty"`
+	TrashID string            `json:"trash_id,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+type PatchResponse struct {
+	Success bool              `json:"success"`
+	Files   []PatchFileResult `json:"files,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// PatchHandler applies a multi-file unified diff. Every file is patched in
+// memory first; if any hunk fails nothing is written.
+func PatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writePatchError(w, "Invalid JSON body", nil)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Patch == "" {
+		writePatchError(w, "patch is required", nil)
+		return
+	}
+
+	patches, err := diff.Parse(req.Patch)
+	if err != nil {
+		writePatchError(w, "invalid patch: "+err.Error(), nil)
+		return
+	}
+
+	log.Printf("HIT: %s | Files: %d", r.URL.Path, len(patches))
+
+	// Validate every path before touching anything
+	var lockPaths []string
+	resolved := make([][2]string, len(patches))
+	for i, fp := range patches {
+		for j, name := range []string{fp.OldName, fp.NewName} {
+			if name == "" {
+				continue
+			}
+			validPath, err := pathutil.ValidateWritePath(name)
+			if err != nil {
+				writePatchError(w, "access denied for '"+name+"': "+err.Error(), nil)
+				return
+			}
+			resolved[i][j] = validPath
+			lockPaths = append(lockPaths, validPath)
+		}
+	}
+
+	unlock := fileutil.LockPaths(lockPaths)
+	defer unlock()
+
+	results, changes, ok := preparePatch(patches, resolved, req.Fuzz)
+	if !ok {
+		writePatchError(w, errPatchRejected.Error(), results)
+		return
+	}
+
+	if !req.DryRun {
+		charge, err := quota.Check(quotaChanges(changes)...)
+		if err != nil {
+			writePatchError(w, err.Error(), results)
+			return
+		}
+		defer charge.Release()
+		if err := snapshotChanges(changes, "patch"); err != nil {
+			writePatchError(w, err.Error(), results)
+			return
+		}
+		trashed, err := applyChanges(changes, r.RemoteAddr)
+		if err != nil {
+			writePatchError(w, err.Error(), results)
+			return
+		}
+		charge.Commit()
+
+		for i, fp := range patches {
+			if fp.IsDelete() || fp.IsRename() {
+				results[i].TrashID = trashed[resolved[i][0]]
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PatchResponse{Success: true, Files: results})
+}
+
+// preparePatch applies each file patch in memory and returns the per-file
+// results and the changes to write. resolved holds each patch's validated
+// old and new paths.
+func preparePatch(patches []diff.FilePatch, resolved [][2]string, fuzz int) ([]PatchFileResult, []fileutil.Change, bool) {
+	results := make([]PatchFileResult, len(patches))
+	var changes []fileutil.Change
+	ok := true
+
+	// A later patch to a file an earlier one already changed applies on top
+	view := newOverlay()
+
+	for i, fp := range patches {
+		oldPath, newPath := resolved[i][0], resolved[i][1]
+		res := &results[i]
+
+		switch {
+		case fp.IsCreate():
+			res.Path, res.Action = newPath, "create"
+		case fp.IsDelete():
+			res.Path, res.Action = oldPath, "delete"
+		case fp.IsRename():
+			res.Path, res.OldPath, res.Action = newPath, oldPath, "rename"
+		default:
+			res.Path, res.Action = newPath, "modify"
+		}
+
+		source := oldPath
+		if fp.IsCreate() {
+			source = newPath
+		}
+		content, exists, err := view.read(source)
+		if err != nil {
+			res.Error = err.Error()
+			ok = false
+			continue
+		}
+		if fp.IsCreate() && exists {
+			res.Error = errFileExists.Error()
+			ok = false
+			continue
+		}
+		if !fp.IsCreate() && !exists {
+			res.Error = errFileNotExist.Error()
+			ok = false
+			continue
+		}
+		if fp.IsRename() {
+			if _, targetExists, _ := view.readRaw(newPath); targetExists {
+				res.Error = errFileExists.Error()
+				ok = false
+				continue
+			}
+		}
+
+		patched, hunks, applied := fp.Apply(content, fuzz)
+		res.Hunks = hunks
+		if !applied {
+			res.Error = "one or more hunks failed"
+			ok = false
+			continue
+		}
+
+		if fp.IsDelete() {
+			if patched != "" {
+				res.Error = diff.ErrNotEmptyOnDelete.Error()
+				ok = false
+				continue
+			}
+			view.remove(oldPath)
+			changes = append(changes, fileutil.Change{Path: oldPath, Delete: true})
+			continue
+		}
+
+		change := fileutil.Change{Path: newPath, Content: []byte(patched)}
+		if fp.IsRename() {
+			if info, err := os.Stat(oldPath); err == nil {
+				change.Perm = info.Mode().Perm()
+			}
+		}
+		view.write(newPath, patched)
+		changes = append(changes, change)
+
+		if fp.IsRename() {
+			view.remove(oldPath)
+			changes = append(changes, fileutil.Change{Path: oldPath, Delete: true})
+		}
+	}
+
+	return results, changes, ok
+}
+
+func writePatchError(w http.ResponseWriter, msg string, files []PatchFileResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(PatchResponse{Error: msg, Files: files})
+}
@@ -0,0 +1,208 @@
+package filescanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/phillip-england/engl/pkg/trash"
+)
+
+func TestPatchHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	reset := func() {
+		os.RemoveAll(filepath.Join(tmpDir, "src"))
+		os.Mkdir(filepath.Join(tmpDir, "src"), 0755)
+		os.WriteFile(filepath.Join(tmpDir, "src", "a.txt"), []byte("one\ntwo\nthree\n"), 0644)
+		os.WriteFile(filepath.Join(tmpDir, "src", "b.txt"), []byte("bee\n"), 0644)
+		os.WriteFile(filepath.Join(tmpDir, "src", "old.txt"), []byte("moved\n"), 0644)
+	}
+
+	multiFile := `--- a/src/a.txt
++++ b/src/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+--- /dev/null
++++ b/src/new/c.txt
+@@ -0,0 +1 @@
++sea
+--- a/src/b.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bee
+diff --git a/src/old.txt b/src/renamed.txt
+rename from src/old.txt
+rename to src/renamed.txt
+`
+
+	badSecondFile := `--- a/src/a.txt
++++ b/src/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+--- a/src/b.txt
++++ b/src/b.txt
+@@ -1 +1 @@
+-not what is there
++x
+`
+
+	readFile := func(rel string) string {
+		content, err := os.ReadFile(filepath.Join(tmpDir, rel))
+		if err != nil {
+			return "<missing>"
+		}
+		return string(content)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		body       any
+		wantStatus int
+		checkResp  func(*testing.T, PatchResponse)
+		verify     func(*testing.T)
+	}{
+		{
+			name:       "multi-file create delete rename",
+			method:     http.MethodPost,
+			body:       PatchRequest{Patch: multiFile},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp PatchResponse) {
+				if !resp.Success || len(resp.Files) != 4 {
+					t.Fatalf("got success=%v files=%d error=%q", resp.Success, len(resp.Files), resp.Error)
+				}
+				actions := []string{"modify", "create", "delete", "rename"}
+				for i, f := range resp.Files {
+					if f.Action != actions[i] {
+						t.Errorf("file %d: got action %q, want %q", i, f.Action, actions[i])
+					}
+				}
+				for i, want := range map[int]string{2: "src/b.txt", 3: "src/old.txt"} {
+					item, err := trash.Lookup(resp.Files[i].TrashID)
+					if err != nil || item.OriginalPath != want {
+						t.Errorf("file %d: %s should be in the trash, got %+v, %v", i, want, item, err)
+					}
+				}
+			},
+			verify: func(t *testing.T) {
+				if got := readFile("src/a.txt"); got != "one\nTWO\nthree\n" {
+					t.Errorf("a.txt: got %q", got)
+				}
+				if got := readFile("src/new/c.txt"); got != "sea\n" {
+					t.Errorf("c.txt: got %q", got)
+				}
+				if got := readFile("src/b.txt"); got != "<missing>" {
+					t.Errorf("b.txt should be deleted, got %q", got)
+				}
+				if got := readFile("src/renamed.txt"); got != "moved\n" {
+					t.Errorf("renamed.txt: got %q", got)
+				}
+				if got := readFile("src/old.txt"); got != "<missing>" {
+					t.Errorf("old.txt should be gone, got %q", got)
+				}
+			},
+		},
+		{
+			name:       "failed hunk rejects whole patch",
+			method:     http.MethodPost,
+			body:       PatchRequest{Patch: badSecondFile},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp PatchResponse) {
+				if resp.Error != "patch does not apply; no files were changed" {
+					t.Errorf("got error %q", resp.Error)
+				}
+				if len(resp.Files) != 2 || !resp.Files[0].Hunks[0].Applied || resp.Files[1].Hunks[0].Applied {
+					t.Errorf("unexpected per-hunk results: %+v", resp.Files)
+				}
+			},
+			verify: func(t *testing.T) {
+				if got := readFile("src/a.txt"); got != "one\ntwo\nthree\n" {
+					t.Errorf("a.txt should be untouched, got %q", got)
+				}
+			},
+		},
+		{
+			name:       "dry run",
+			method:     http.MethodPost,
+			body:       PatchRequest{Patch: multiFile, DryRun: true},
+			wantStatus: http.StatusOK,
+			checkResp:  nil,
+			verify: func(t *testing.T) {
+				if got := readFile("src/b.txt"); got != "bee\n" {
+					t.Errorf("dry run changed b.txt: %q", got)
+				}
+			},
+		},
+		{
+			name:       "path outside root",
+			method:     http.MethodPost,
+			body:       PatchRequest{Patch: "--- a/../../etc/passwd\n+++ b/../../etc/passwd\n@@ -1 +1 @@\n-x\n+y\n"},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp PatchResponse) {
+				if resp.Error == "" {
+					t.Error("expected access denied error")
+				}
+			},
+		},
+		{
+			name:       "missing patch",
+			method:     http.MethodPost,
+			body:       PatchRequest{},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp PatchResponse) {
+				if resp.Error != "patch is required" {
+					t.Errorf("got error %q", resp.Error)
+				}
+			},
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodGet,
+			body:       nil,
+			wantStatus: http.StatusMethodNotAllowed,
+			checkResp:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset()
+
+			var body bytes.Buffer
+			if tt.body != nil {
+				json.NewEncoder(&body).Encode(tt.body)
+			}
+
+			req := httptest.NewRequest(tt.method, "/mcp/tool/file_scanner/patch", &body)
+			rec := httptest.NewRecorder()
+
+			PatchHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			if tt.checkResp != nil {
+				var resp PatchResponse
+				json.NewDecoder(rec.Body).Decode(&resp)
+				tt.checkResp(t, resp)
+			}
+
+			if tt.verify != nil {
+				tt.verify(t)
+			}
+		})
+	}
+}
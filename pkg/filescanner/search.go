@@ -0,0 +1,220 @@
+package filescanner
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/phillip-england/engl/pkg/pathutil"
+)
+
+const (
+	defaultMaxResults = 100
+	maxContextLines   = 20
+	maxSearchFileSize = 10 << 20
+)
+
+type SearchRequest struct {
+	Pattern      string `json:"pattern"`
+	Literal      bool   `json:"literal"`
+	Path         string `json:"path"`
+	Glob         string `json:"glob"`
+	IgnoreCase   bool   `json:"ignore_case"`
+	ContextLines int    `json:"context_lines"`
+	MaxResults   int    `json:"max_results"`
+}
+
+type SearchMatch struct {
+	File   string   `json:"file"`
+	Line   int      `json:"line"`
+	Column int      `json:"column"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+type SearchResponse struct {
+	Matches       []SearchMatch `json:"matches"`
+	FilesSearched int           `json:"files_searched"`
+	Truncated     bool          `json:"truncated"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// SearchHandler searches file contents under a path for a regex or literal
+func SearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeSearchError(w, "Invalid JSON body")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Pattern == "" {
+		writeSearchError(w, "pattern is required")
+		return
+	}
+
+	if req.Path == "" {
+		req.Path = pathutil.GetAllowedRoot()
+	}
+
+	validPath, err := pathutil.ValidatePath(req.Path)
+	if err != nil {
+		writeSearchError(w, "access denied: "+err.Error())
+		return
+	}
+
+	re, err := compileSearchPattern(req.Pattern, req.Literal, req.IgnoreCase)
+	if err != nil {
+		writeSearchError(w, "invalid pattern: "+err.Error())
+		return
+	}
+
+	if req.ContextLines < 0 {
+		req.ContextLines = 0
+	}
+	if req.ContextLines > maxContextLines {
+		req.ContextLines = maxContextLines
+	}
+	if req.MaxResults <= 0 {
+		req.MaxResults = defaultMaxResults
+	}
+
+	log.Printf("HIT: %s | Path: %s | Pattern: %s", r.URL.Path, validPath, req.Pattern)
+
+	files, err := collectFiles(validPath, req.Glob)
+	if err != nil {
+		writeSearchError(w, err.Error())
+		return
+	}
+
+	matches, truncated := searchFiles(files, re, req.ContextLines, req.MaxResults)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SearchResponse{
+		Matches:       matches,
+		FilesSearched: len(files),
+		Truncated:     truncated,
+	})
+}
+
+func compileSearchPattern(pattern string, literal, ignoreCase bool) (*regexp.Regexp, error) {
+	if literal {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// searchFiles searches files in parallel. Files are handed out in order and
+// dispatch stops once maxResults matches are found, so the returned matches
+// are always the first maxResults in file order.
+func searchFiles(files []string, re *regexp.Regexp, contextLines, maxResults int) ([]SearchMatch, bool) {
+	results := make([][]SearchMatch, len(files))
+	var found atomic.Int64
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = searchFile(files[i], re, contextLines)
+				found.Add(int64(len(results[i])))
+			}
+		}()
+	}
+
+	for i := range files {
+		if found.Load() > int64(maxResults) {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	matches := []SearchMatch{}
+	for _, fileMatches := range results {
+		matches = append(matches, fileMatches...)
+	}
+
+	if len(matches) > maxResults {
+		return matches[:maxResults], true
+	}
+	return matches, false
+}
+
+// searchFile returns every line of path matching re. Unreadable, oversized
+// and binary files produce no matches.
+func searchFile(path string, re *regexp.Regexp, contextLines int) []SearchMatch {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > maxSearchFileSize {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || isBinary(data) {
+		return nil
+	}
+
+	lines := strings.Split(string(data), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var matches []SearchMatch
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		loc := re.FindStringIndex(line)
+		if loc == nil {
+			continue
+		}
+
+		match := SearchMatch{
+			File:   path,
+			Line:   i + 1,
+			Column: loc[0] + 1,
+			Text:   line,
+		}
+		if contextLines > 0 {
+			match.Before = contextSlice(lines, i-contextLines, i)
+			match.After = contextSlice(lines, i+1, i+1+contextLines)
+		}
+		matches = append(matches, match)
+	}
+	return matches
+}
+
+func contextSlice(lines []string, start, end int) []string {
+	start = max(start, 0)
+	end = min(end, len(lines))
+	if start >= end {
+		return nil
+	}
+	out := make([]string, 0, end-start)
+	for _, l := range lines[start:end] {
+		out = append(out, strings.TrimSuffix(l, "\r"))
+	}
+	return out
+}
+
+func writeSearchError(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(SearchResponse{Error: msg})
+}
@@ -0,0 +1,167 @@
+package filescanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSearchHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	os.Mkdir(filepath.Join(tmpDir, "pkg"), 0755)
+	os.Mkdir(filepath.Join(tmpDir, ".git"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main\n\nfunc main() {\n\tHello()\n}\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "pkg", "hello.go"), []byte("package pkg\n\nfunc Hello() {}\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "notes.txt"), []byte("say hello.world\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "blob.bin"), []byte("Hello\x00binary"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, ".git", "HEAD"), []byte("Hello from git\n"), 0644)
+
+	tests := []struct {
+		name       string
+		method     string
+		body       any
+		wantStatus int
+		checkResp  func(*testing.T, SearchResponse)
+	}{
+		{
+			name:       "regex across root",
+			method:     http.MethodPost,
+			body:       SearchRequest{Pattern: `func \w+\(`},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp SearchResponse) {
+				if resp.Error != "" {
+					t.Errorf("unexpected error: %s", resp.Error)
+				}
+				if len(resp.Matches) != 2 {
+					t.Fatalf("got %d matches, want 2", len(resp.Matches))
+				}
+				m := resp.Matches[0]
+				if m.File != filepath.Join(tmpDir, "main.go") || m.Line != 3 || m.Column != 1 {
+					t.Errorf("got %s:%d:%d, want main.go:3:1", m.File, m.Line, m.Column)
+				}
+			},
+		},
+		{
+			name:       "skips binaries and ignored dirs",
+			method:     http.MethodPost,
+			body:       SearchRequest{Pattern: "Hello"},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp SearchResponse) {
+				for _, m := range resp.Matches {
+					if filepath.Base(m.File) == "blob.bin" || filepath.Base(m.File) == "HEAD" {
+						t.Errorf("unexpected match in %s", m.File)
+					}
+				}
+				if len(resp.Matches) != 2 {
+					t.Errorf("got %d matches, want 2", len(resp.Matches))
+				}
+			},
+		},
+		{
+			name:       "literal ignore case",
+			method:     http.MethodPost,
+			body:       SearchRequest{Pattern: "HELLO.WORLD", Literal: true, IgnoreCase: true},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp SearchResponse) {
+				if len(resp.Matches) != 1 {
+					t.Fatalf("got %d matches, want 1", len(resp.Matches))
+				}
+				if resp.Matches[0].Column != 5 {
+					t.Errorf("got column %d, want 5", resp.Matches[0].Column)
+				}
+			},
+		},
+		{
+			name:       "glob and context lines",
+			method:     http.MethodPost,
+			body:       SearchRequest{Pattern: "Hello", Glob: "*.go", Path: filepath.Join(tmpDir, "pkg"), ContextLines: 1},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp SearchResponse) {
+				if len(resp.Matches) != 1 {
+					t.Fatalf("got %d matches, want 1", len(resp.Matches))
+				}
+				m := resp.Matches[0]
+				if len(m.Before) != 1 || m.Before[0] != "" || len(m.After) != 0 {
+					t.Errorf("got before %q after %q", m.Before, m.After)
+				}
+			},
+		},
+		{
+			name:       "result cap",
+			method:     http.MethodPost,
+			body:       SearchRequest{Pattern: "package", MaxResults: 1},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp SearchResponse) {
+				if len(resp.Matches) != 1 || !resp.Truncated {
+					t.Errorf("got %d matches truncated=%v, want 1 truncated", len(resp.Matches), resp.Truncated)
+				}
+			},
+		},
+		{
+			name:       "missing pattern",
+			method:     http.MethodPost,
+			body:       SearchRequest{},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp SearchResponse) {
+				if resp.Error != "pattern is required" {
+					t.Errorf("got error %q, want %q", resp.Error, "pattern is required")
+				}
+			},
+		},
+		{
+			name:       "invalid regex",
+			method:     http.MethodPost,
+			body:       SearchRequest{Pattern: "("},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp SearchResponse) {
+				if resp.Error == "" {
+					t.Error("expected an error for invalid regex")
+				}
+			},
+		},
+		{
+			name:       "path outside root",
+			method:     http.MethodPost,
+			body:       SearchRequest{Pattern: "x", Path: "/etc"},
+			wantStatus: http.StatusBadRequest,
+			checkResp:  nil,
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodGet,
+			body:       nil,
+			wantStatus: http.StatusMethodNotAllowed,
+			checkResp:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			if tt.body != nil {
+				json.NewEncoder(&body).Encode(tt.body)
+			}
+
+			req := httptest.NewRequest(tt.method, "/mcp/tool/file_scanner/search", &body)
+			rec := httptest.NewRecorder()
+
+			SearchHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			if tt.checkResp != nil {
+				var resp SearchResponse
+				json.NewDecoder(rec.Body).Decode(&resp)
+				tt.checkResp(t, resp)
+			}
+		})
+	}
+}
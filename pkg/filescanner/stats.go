@@ -0,0 +1,307 @@
+package filescanner
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/phillip-england/engl/pkg/pathutil"
+)
+
+const defaultLargestFiles = 10
+
+type language struct {
+	Name       string
+	LineCmt    []string
+	BlockStart string
+	BlockEnd   string
+}
+
+var (
+	cStyle    = language{LineCmt: []string{"//"}, BlockStart: "/*", BlockEnd: "*/"}
+	hashStyle = language{LineCmt: []string{"#"}}
+	markup    = language{BlockStart: "<!--", BlockEnd: "-->"}
+)
+
+func lang(name string, style language) language {
+	style.Name = name
+	return style
+}
+
+// languages maps file extensions to a language and its comment syntax
+var languages = map[string]language{
+	".go":    lang("Go", cStyle),
+	".c":     lang("C", cStyle),
+	".h":     lang("C", cStyle),
+	".cpp":   lang("C++", cStyle),
+	".hpp":   lang("C++", cStyle),
+	".rs":    lang("Rust", cStyle),
+	".java":  lang("Java", cStyle),
+	".js":    lang("JavaScript", cStyle),
+	".mjs":   lang("JavaScript", cStyle),
+	".jsx":   lang("JavaScript", cStyle),
+	".ts":    lang("TypeScript", cStyle),
+	".tsx":   lang("TypeScript", cStyle),
+	".css":   lang("CSS", language{BlockStart: "/*", BlockEnd: "*/"}),
+	".py":    lang("Python", hashStyle),
+	".rb":    lang("Ruby", hashStyle),
+	".sh":    lang("Shell", hashStyle),
+	".yaml":  lang("YAML", hashStyle),
+	".yml":   lang("YAML", hashStyle),
+	".toml":  lang("TOML", hashStyle),
+	".sql":   lang("SQL", language{LineCmt: []string{"--"}, BlockStart: "/*", BlockEnd: "*/"}),
+	".lua":   lang("Lua", language{LineCmt: []string{"--"}}),
+	".html":  lang("HTML", markup),
+	".xml":   lang("XML", markup),
+	".md":    lang("Markdown", language{}),
+	".json":  lang("JSON", language{}),
+	".txt":   lang("Text", language{}),
+	".mod":   lang("Go Module", cStyle),
+	".sum":   lang("Go Checksums", language{}),
+	".engl":  lang("engl", language{}),
+	".jsonl": lang("JSON Lines", language{}),
+}
+
+// fileNameLanguages covers well-known files without a useful extension
+var fileNameLanguages = map[string]language{
+	"Makefile":   lang("Makefile", hashStyle),
+	"Dockerfile": lang("Dockerfile", hashStyle),
+}
+
+type StatsRequest struct {
+	Path    string `json:"path"`
+	Largest int    `json:"largest"`
+}
+
+type LineCounts struct {
+	Code    int `json:"code"`
+	Comment int `json:"comment"`
+	Blank   int `json:"blank"`
+}
+
+type LanguageStats struct {
+	Language string `json:"language"`
+	Files    int    `json:"files"`
+	Bytes    int64  `json:"bytes"`
+	LineCounts
+}
+
+type FileSize struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+type StatsResponse struct {
+	Files     int             `json:"files"`
+	Bytes     int64           `json:"bytes"`
+	Lines     LineCounts      `json:"lines"`
+	Languages []LanguageStats `json:"languages,omitempty"`
+	Largest   []FileSize      `json:"largest,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// StatsHandler reports file, byte and line counts for a directory
+func StatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req StatsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeStatsError(w, "Invalid JSON body")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Path == "" {
+		req.Path = pathutil.GetAllowedRoot()
+	}
+
+	validPath, err := pathutil.ValidatePath(req.Path)
+	if err != nil {
+		writeStatsError(w, "access denied: "+err.Error())
+		return
+	}
+
+	if req.Largest <= 0 {
+		req.Largest = defaultLargestFiles
+	}
+
+	log.Printf("HIT: %s | Path: %s", r.URL.Path, validPath)
+
+	files, err := collectFiles(validPath, "")
+	if err != nil {
+		writeStatsError(w, err.Error())
+		return
+	}
+
+	resp := StatsResponse{}
+	byLang := map[string]*LanguageStats{}
+	var sizes []FileSize
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+
+		l := detectLanguage(file)
+		stats, ok := byLang[l.Name]
+		if !ok {
+			stats = &LanguageStats{Language: l.Name}
+			byLang[l.Name] = stats
+		}
+
+		stats.Files++
+		stats.Bytes += info.Size()
+		resp.Files++
+		resp.Bytes += info.Size()
+		sizes = append(sizes, FileSize{Path: file, Bytes: info.Size()})
+
+		if info.Size() > maxSearchFileSize {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil || isBinary(data) {
+			continue
+		}
+
+		counts := countLines(string(data), l)
+		stats.Code += counts.Code
+		stats.Comment += counts.Comment
+		stats.Blank += counts.Blank
+		resp.Lines.Code += counts.Code
+		resp.Lines.Comment += counts.Comment
+		resp.Lines.Blank += counts.Blank
+	}
+
+	for _, stats := range byLang {
+		resp.Languages = append(resp.Languages, *stats)
+	}
+	sort.Slice(resp.Languages, func(i, j int) bool {
+		a, b := resp.Languages[i], resp.Languages[j]
+		if a.Code != b.Code {
+			return a.Code > b.Code
+		}
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Language < b.Language
+	})
+
+	sort.SliceStable(sizes, func(i, j int) bool {
+		return sizes[i].Bytes > sizes[j].Bytes
+	})
+	if len(sizes) > req.Largest {
+		sizes = sizes[:req.Largest]
+	}
+	resp.Largest = sizes
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// detectLanguage picks a language by file name, then by extension, falling
+// back to the bare extension (or "Other") with no comment syntax
+func detectLanguage(path string) language {
+	base := filepath.Base(path)
+	if l, ok := fileNameLanguages[base]; ok {
+		return l
+	}
+
+	ext := strings.ToLower(filepath.Ext(base))
+	if l, ok := languages[ext]; ok {
+		return l
+	}
+	if ext != "" {
+		return language{Name: ext}
+	}
+	return language{Name: "Other"}
+}
+
+// countLines classifies each line as code, comment or blank. A line holding
+// both code and a comment counts as code.
+func countLines(content string, l language) LineCounts {
+	var counts LineCounts
+	inBlock := false
+
+	lines := strings.Split(content, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if inBlock {
+			idx := strings.Index(line, l.BlockEnd)
+			if idx == -1 {
+				if line == "" {
+					counts.Blank++
+				} else {
+					counts.Comment++
+				}
+				continue
+			}
+			inBlock = false
+			if rest := strings.TrimSpace(line[idx+len(l.BlockEnd):]); rest != "" && !isCommentOnly(rest, l) {
+				counts.Code++
+			} else {
+				counts.Comment++
+			}
+			continue
+		}
+
+		if line == "" {
+			counts.Blank++
+			continue
+		}
+
+		if isCommentOnly(line, l) {
+			counts.Comment++
+			if l.BlockStart != "" && strings.HasPrefix(line, l.BlockStart) &&
+				!strings.Contains(line[len(l.BlockStart):], l.BlockEnd) {
+				inBlock = true
+			}
+			continue
+		}
+
+		counts.Code++
+		if l.BlockStart != "" {
+			if idx := strings.LastIndex(line, l.BlockStart); idx != -1 &&
+				!strings.Contains(line[idx+len(l.BlockStart):], l.BlockEnd) {
+				inBlock = true
+			}
+		}
+	}
+
+	return counts
+}
+
+func isCommentOnly(line string, l language) bool {
+	for _, prefix := range l.LineCmt {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	if l.BlockStart == "" || !strings.HasPrefix(line, l.BlockStart) {
+		return false
+	}
+	idx := strings.Index(line[len(l.BlockStart):], l.BlockEnd)
+	if idx == -1 {
+		return true
+	}
+	rest := strings.TrimSpace(line[len(l.BlockStart)+idx+len(l.BlockEnd):])
+	return rest == "" || isCommentOnly(rest, l)
+}
+
+func writeStatsError(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(StatsResponse{Error: msg})
+}
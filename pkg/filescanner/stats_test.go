@@ -0,0 +1,115 @@
+package filescanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatsHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	goSrc := "// Package x does things.\npackage x\n\n/*\nblock\n*/\nfunc A() {} // trailing\n"
+	pySrc := "# comment\nimport os\n\n"
+	os.Mkdir(filepath.Join(tmpDir, "src"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "src", "x.go"), []byte(goSrc), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "tool.py"), []byte(pySrc), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "image.bin"), []byte("\x00\x01\x02\x03\n\n"), 0644)
+
+	tests := []struct {
+		name       string
+		method     string
+		body       any
+		wantStatus int
+		checkResp  func(*testing.T, StatsResponse)
+	}{
+		{
+			name:       "counts by language",
+			method:     http.MethodPost,
+			body:       StatsRequest{Path: tmpDir},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp StatsResponse) {
+				if resp.Error != "" {
+					t.Fatalf("unexpected error: %s", resp.Error)
+				}
+				if resp.Files != 3 {
+					t.Errorf("got %d files, want 3", resp.Files)
+				}
+				wantBytes := int64(len(goSrc) + len(pySrc) + 6)
+				if resp.Bytes != wantBytes {
+					t.Errorf("got %d bytes, want %d", resp.Bytes, wantBytes)
+				}
+				if resp.Lines != (LineCounts{Code: 3, Comment: 5, Blank: 2}) {
+					t.Errorf("got lines %+v, want code 3 comment 5 blank 2", resp.Lines)
+				}
+				if len(resp.Languages) != 3 || resp.Languages[0].Language != "Go" {
+					t.Fatalf("unexpected languages: %+v", resp.Languages)
+				}
+				if resp.Languages[0].LineCounts != (LineCounts{Code: 2, Comment: 4, Blank: 1}) {
+					t.Errorf("got Go lines %+v", resp.Languages[0].LineCounts)
+				}
+				if len(resp.Largest) != 3 || filepath.Base(resp.Largest[0].Path) != "x.go" {
+					t.Errorf("unexpected largest files: %+v", resp.Largest)
+				}
+			},
+		},
+		{
+			name:       "largest limit",
+			method:     http.MethodPost,
+			body:       StatsRequest{Path: tmpDir, Largest: 1},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp StatsResponse) {
+				if len(resp.Largest) != 1 {
+					t.Errorf("got %d largest files, want 1", len(resp.Largest))
+				}
+			},
+		},
+		{
+			name:       "path outside root",
+			method:     http.MethodPost,
+			body:       StatsRequest{Path: "/etc"},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp StatsResponse) {
+				if resp.Error == "" {
+					t.Error("expected an error for path outside root")
+				}
+			},
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodGet,
+			body:       nil,
+			wantStatus: http.StatusMethodNotAllowed,
+			checkResp:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			if tt.body != nil {
+				json.NewEncoder(&body).Encode(tt.body)
+			}
+
+			req := httptest.NewRequest(tt.method, "/mcp/tool/file_scanner/stats", &body)
+			rec := httptest.NewRecorder()
+
+			StatsHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			if tt.checkResp != nil {
+				var resp StatsResponse
+				json.NewDecoder(rec.Body).Decode(&resp)
+				tt.checkResp(t, resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package filescanner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/phillip-england/engl/pkg/fileutil"
+	"github.com/phillip-england/engl/pkg/history"
+	"github.com/phillip-england/engl/pkg/pathutil"
+	"github.com/phillip-england/engl/pkg/quota"
+)
+
+const (
+	TxOpWrite  = "write"
+	TxOpEdit   = "edit"
+	TxOpMove   = "move"
+	TxOpDelete = "delete"
+)
+
+// TransactionOp is one step of a transaction. Which fields apply depends on
+// Op: write uses Content and Mode, edit uses OldString, NewString and
+// ReplaceAll, and move uses Destination. Ops act on files, not directories;
+// write and edit need text files while move and delete take any file.
+// ExpectedHash is checked against the file as earlier steps in the
+// transaction leave it.
+type TransactionOp struct {
+	Op           string `json:"op"`
+	Path         string `json:"path"`
+	Content      string `json:"content,omitempty"`
+	Mode         string `json:"mode,omitempty"`
+	OldString    string `json:"old_string,omitempty"`
+	NewString    string `json:"new_string,omitempty"`
+	ReplaceAll   bool   `json:"replace_all,omitempty"`
+	Destination  string `json:"destination,omitempty"`
+	ExpectedHash string `json:"expected_hash,omitempty"`
+}
+
+type TransactionRequest struct {
+	Operations []TransactionOp `json:"operations"`
+}
+
+type TransactionOpResult struct {
+	Op          string `json:"op"`
+	Path        string `json:"path"`
+	Destination string `json:"destination,omitempty"`
+	Hash        string `json:"hash,omitempty"`
+	TrashID     string `json:"trash_id,omitempty"`
+}
+
+type TransactionResponse struct {
+	Success    bool                  `json:"success"`
+	Results    []TransactionOpResult `json:"results,omitempty"`
+	FailedOp   int                   `json:"failed_op,omitempty"`
+	RolledBack bool                  `json:"rolled_back,omitempty"`
+	Error      string                `json:"error,omitempty"`
+}
+
+// TransactionHandler applies an ordered list of file operations all or
+// nothing. Every operation is validated against an in-memory view of the
+// files first; if writing then fails partway, completed steps are rolled back.
+func TransactionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeTransactionError(w, TransactionResponse{Error: "Invalid JSON body"})
+		return
+	}
+	defer r.Body.Close()
+
+	if len(req.Operations) == 0 {
+		writeTransactionError(w, TransactionResponse{Error: "operations are required"})
+		return
+	}
+
+	log.Printf("HIT: %s | Operations: %d", r.URL.Path, len(req.Operations))
+
+	// Resolve every path before locking so the lock set is known up front
+	paths := make([][2]string, len(req.Operations))
+	var lockPaths []string
+	for i, op := range req.Operations {
+		src, dst, err := resolveTxPaths(op)
+		if err != nil {
+			writeTransactionError(w, TransactionResponse{FailedOp: i + 1, Error: txError(i, op, err)})
+			return
+		}
+		paths[i] = [2]string{src, dst}
+		lockPaths = append(lockPaths, src)
+		if dst != "" {
+			lockPaths = append(lockPaths, dst)
+		}
+	}
+
+	unlock := fileutil.LockPaths(lockPaths)
+	defer unlock()
+
+	view := newOverlay()
+	var changes []fileutil.Change
+	results := make([]TransactionOpResult, len(req.Operations))
+
+	for i, op := range req.Operations {
+		src, dst := paths[i][0], paths[i][1]
+		opChanges, result, err := planTxOp(view, op, src, dst)
+		if err != nil {
+			writeTransactionError(w, TransactionResponse{FailedOp: i + 1, Error: txError(i, op, err)})
+			return
+		}
+		changes = append(changes, opChanges...)
+		results[i] = result
+	}
+
+	charge, err := quota.Check(quotaChanges(changes)...)
+	if err != nil {
+		writeTransactionError(w, TransactionResponse{Error: err.Error()})
+		return
+	}
+	defer charge.Release()
+
+	if err := snapshotChanges(changes, "transaction"); err != nil {
+		writeTransactionError(w, TransactionResponse{Error: err.Error()})
+		return
+	}
+
+	trashed, err := applyChanges(changes, r.RemoteAddr)
+	if err != nil {
+		writeTransactionError(w, TransactionResponse{RolledBack: true, Error: err.Error()})
+		return
+	}
+	charge.Commit()
+
+	for i, op := range req.Operations {
+		if op.Op == TxOpDelete || op.Op == TxOpMove {
+			results[i].TrashID = trashed[paths[i][0]]
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TransactionResponse{Success: true, Results: results})
+}
+
+func resolveTxPaths(op TransactionOp) (string, string, error) {
+	if op.Path == "" {
+		return "", "", errors.New("path is required")
+	}
+	src, err := pathutil.ValidateWritePath(op.Path)
+	if err != nil {
+		return "", "", errors.New("access denied: " + err.Error())
+	}
+
+	if op.Op != TxOpMove {
+		return src, "", nil
+	}
+	if op.Destination == "" {
+		return "", "", errors.New("destination is required")
+	}
+	dst, err := pathutil.ValidateWritePath(op.Destination)
+	if err != nil {
+		return "", "", errors.New("access denied: " + err.Error())
+	}
+	return src, dst, nil
+}
+
+// planTxOp validates op against view, records its effect in view, and
+// returns the changes that will carry it out
+func planTxOp(view *overlay, op TransactionOp, src, dst string) ([]fileutil.Change, TransactionOpResult, error) {
+	result := TransactionOpResult{Op: op.Op, Path: src, Destination: dst}
+
+	// Move and delete carry the bytes over unchanged, so any file will do
+	read := view.read
+	if op.Op == TxOpMove || op.Op == TxOpDelete {
+		read = view.readRaw
+	}
+	content, exists, err := read(src)
+	if err != nil {
+		return nil, result, err
+	}
+
+	if op.ExpectedHash != "" {
+		current := ""
+		if exists {
+			current = fileutil.Hash([]byte(content))
+		}
+		if current != op.ExpectedHash {
+			return nil, result, fileutil.ErrConflict
+		}
+	}
+
+	switch op.Op {
+	case TxOpWrite:
+		next, err := resolveWriteMode(op.Mode, exists, []byte(content), []byte(op.Content))
+		if err != nil {
+			return nil, result, err
+		}
+		view.write(src, string(next))
+		result.Hash = fileutil.Hash(next)
+		return []fileutil.Change{{Path: src, Content: next}}, result, nil
+
+	case TxOpEdit:
+		if !exists {
+			return nil, result, errFileNotExist
+		}
+		if op.OldString == "" {
+			return nil, result, errors.New("old_string is required")
+		}
+		next, _, err := replaceString(content, op.OldString, op.NewString, op.ReplaceAll)
+		if err != nil {
+			return nil, result, err
+		}
+		view.write(src, next)
+		result.Hash = fileutil.Hash([]byte(next))
+		return []fileutil.Change{{Path: src, Content: []byte(next)}}, result, nil
+
+	case TxOpMove:
+		if !exists {
+			return nil, result, errFileNotExist
+		}
+		if _, dstExists, err := view.readRaw(dst); err != nil {
+			return nil, result, err
+		} else if dstExists {
+			return nil, result, errors.New("destination already exists")
+		}
+		move := fileutil.Change{Path: dst, Content: []byte(content)}
+		if info, err := os.Stat(src); err == nil {
+			move.Perm = info.Mode().Perm()
+		}
+		view.write(dst, content)
+		view.remove(src)
+		return []fileutil.Change{move, {Path: src, Delete: true}}, result, nil
+
+	case TxOpDelete:
+		if !exists {
+			return nil, result, errFileNotExist
+		}
+		view.remove(src)
+		return []fileutil.Change{{Path: src, Delete: true}}, result, nil
+	}
+
+	return nil, result, errors.New("invalid op: " + op.Op)
+}
+
+// snapshotChanges records the current content of every file a batch of
+// changes is about to touch
+func snapshotChanges(changes []fileutil.Change, op string) error {
+	seen := map[string]bool{}
+	for _, c := range changes {
+		if seen[c.Path] {
+			continue
+		}
+		seen[c.Path] = true
+		if err := history.Snapshot(c.Path, op); err != nil {
+			return errors.New("history snapshot failed: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// quotaChanges describes a batch of changes for the quota check
+func quotaChanges(changes []fileutil.Change) []quota.Change {
+	out := make([]quota.Change, len(changes))
+	for i, c := range changes {
+		out[i] = quota.Change{Path: c.Path, Size: int64(len(c.Content)), Delete: c.Delete}
+	}
+	return out
+}
+
+func txError(i int, op TransactionOp, err error) string {
+	return fmt.Sprintf("operation %d (%s %s): %s", i+1, op.Op, op.Path, err.Error())
+}
+
+// overlay is an in-memory view of files on top of the disk, used to validate
+// a batch of changes before any of them are written. Directories read as an
+// error, since a batch is rolled back file by file.
+type overlay struct {
+	files map[string]*string // nil marks a file removed earlier in the batch
+}
+
+func newOverlay() *overlay {
+	return &overlay{files: map[string]*string{}}
+}
+
+// read returns a file's content as earlier changes in the batch leave it.
+// Binary files read as an error.
+func (o *overlay) read(path string) (string, bool, error) {
+	content, exists, err := o.readRaw(path)
+	if err == nil && isBinary([]byte(content)) {
+		return "", false, errBinaryFile
+	}
+	return content, exists, err
+}
+
+// readRaw is read without the binary check, for files whose bytes are
+// moved or deleted rather than edited
+func (o *overlay) readRaw(path string) (string, bool, error) {
+	if c, seen := o.files[path]; seen {
+		if c == nil {
+			return "", false, nil
+		}
+		return *c, true, nil
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if info.IsDir() {
+		return "", false, errIsDirectory
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, err
+	}
+	return string(data), true, nil
+}
+
+func (o *overlay) write(path, content string) {
+	o.files[path] = &content
+}
+
+func (o *overlay) remove(path string) {
+	o.files[path] = nil
+}
+
+func writeTransactionError(w http.ResponseWriter, resp TransactionResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(resp)
+}
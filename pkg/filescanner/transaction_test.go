@@ -0,0 +1,261 @@
+package filescanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/phillip-england/engl/pkg/fileutil"
+	"github.com/phillip-england/engl/pkg/trash"
+)
+
+func TestTransactionHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	reset := func() {
+		os.RemoveAll(filepath.Join(tmpDir, "pkg"))
+		os.Mkdir(filepath.Join(tmpDir, "pkg"), 0755)
+		os.WriteFile(filepath.Join(tmpDir, "pkg", "a.go"), []byte("package pkg\n\nfunc Old() {}\n"), 0644)
+		os.WriteFile(filepath.Join(tmpDir, "pkg", "b.go"), []byte("package pkg\n\nvar x = Old\n"), 0644)
+		os.WriteFile(filepath.Join(tmpDir, "pkg", "dead.go"), []byte("package pkg\n"), 0644)
+		os.WriteFile(filepath.Join(tmpDir, "pkg", "logo.png"), []byte("\x89PNG\x00\x01"), 0644)
+		os.WriteFile(filepath.Join(tmpDir, "pkg", "old.bin"), []byte("\x00\x00"), 0644)
+		os.Mkdir(filepath.Join(tmpDir, "pkg", "sub"), 0755)
+	}
+
+	readFile := func(rel string) string {
+		content, err := os.ReadFile(filepath.Join(tmpDir, rel))
+		if err != nil {
+			return "<missing>"
+		}
+		return string(content)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		body       any
+		wantStatus int
+		checkResp  func(*testing.T, TransactionResponse)
+		verify     func(*testing.T)
+	}{
+		{
+			name:   "refactor across files",
+			method: http.MethodPost,
+			body: TransactionRequest{Operations: []TransactionOp{
+				{Op: TxOpEdit, Path: "pkg/a.go", OldString: "func Old()", NewString: "func New()"},
+				{Op: TxOpEdit, Path: "pkg/b.go", OldString: "= Old", NewString: "= New"},
+				{Op: TxOpMove, Path: "pkg/b.go", Destination: "pkg/c.go"},
+				{Op: TxOpWrite, Path: "pkg/sub/d.go", Content: "package sub\n", Mode: WriteModeCreate},
+				{Op: TxOpDelete, Path: "pkg/dead.go"},
+			}},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp TransactionResponse) {
+				if !resp.Success || len(resp.Results) != 5 {
+					t.Fatalf("got success=%v results=%d error=%q", resp.Success, len(resp.Results), resp.Error)
+				}
+				item, err := trash.Lookup(resp.Results[4].TrashID)
+				if err != nil || item.OriginalPath != "pkg/dead.go" {
+					t.Errorf("deleted file should be in the trash, got %+v, %v", item, err)
+				}
+				if resp.Results[3].TrashID != "" {
+					t.Errorf("write should not report a trash id, got %q", resp.Results[3].TrashID)
+				}
+			},
+			verify: func(t *testing.T) {
+				if got := readFile("pkg/a.go"); got != "package pkg\n\nfunc New() {}\n" {
+					t.Errorf("a.go: got %q", got)
+				}
+				if got := readFile("pkg/c.go"); got != "package pkg\n\nvar x = New\n" {
+					t.Errorf("c.go: got %q", got)
+				}
+				if got := readFile("pkg/sub/d.go"); got != "package sub\n" {
+					t.Errorf("d.go: got %q", got)
+				}
+				for _, gone := range []string{"pkg/b.go", "pkg/dead.go"} {
+					if got := readFile(gone); got != "<missing>" {
+						t.Errorf("%s should be gone, got %q", gone, got)
+					}
+				}
+			},
+		},
+		{
+			name:   "failing op leaves everything untouched",
+			method: http.MethodPost,
+			body: TransactionRequest{Operations: []TransactionOp{
+				{Op: TxOpEdit, Path: "pkg/a.go", OldString: "func Old()", NewString: "func New()"},
+				{Op: TxOpDelete, Path: "pkg/dead.go"},
+				{Op: TxOpEdit, Path: "pkg/dead.go", OldString: "package", NewString: "x"},
+			}},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp TransactionResponse) {
+				if resp.FailedOp != 3 {
+					t.Errorf("got failed op %d, want 3", resp.FailedOp)
+				}
+				want := "operation 3 (edit pkg/dead.go): file does not exist"
+				if resp.Error != want {
+					t.Errorf("got error %q, want %q", resp.Error, want)
+				}
+			},
+			verify: func(t *testing.T) {
+				if got := readFile("pkg/a.go"); got != "package pkg\n\nfunc Old() {}\n" {
+					t.Errorf("a.go should be untouched, got %q", got)
+				}
+				if got := readFile("pkg/dead.go"); got != "package pkg\n" {
+					t.Errorf("dead.go should be untouched, got %q", got)
+				}
+			},
+		},
+		{
+			name:   "move and delete binary files",
+			method: http.MethodPost,
+			body: TransactionRequest{Operations: []TransactionOp{
+				{Op: TxOpMove, Path: "pkg/logo.png", Destination: "pkg/assets/logo.png"},
+				{Op: TxOpDelete, Path: "pkg/old.bin"},
+			}},
+			wantStatus: http.StatusOK,
+			verify: func(t *testing.T) {
+				if got := readFile("pkg/assets/logo.png"); got != "\x89PNG\x00\x01" {
+					t.Errorf("logo.png: got %q", got)
+				}
+				for _, gone := range []string{"pkg/logo.png", "pkg/old.bin"} {
+					if got := readFile(gone); got != "<missing>" {
+						t.Errorf("%s should be gone, got %q", gone, got)
+					}
+				}
+			},
+		},
+		{
+			name:   "edit binary file",
+			method: http.MethodPost,
+			body: TransactionRequest{Operations: []TransactionOp{
+				{Op: TxOpEdit, Path: "pkg/logo.png", OldString: "PNG", NewString: "GIF"},
+			}},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp TransactionResponse) {
+				want := "operation 1 (edit pkg/logo.png): file appears to be binary"
+				if resp.Error != want {
+					t.Errorf("got error %q, want %q", resp.Error, want)
+				}
+			},
+		},
+		{
+			name:   "delete directory",
+			method: http.MethodPost,
+			body: TransactionRequest{Operations: []TransactionOp{
+				{Op: TxOpDelete, Path: "pkg/sub"},
+			}},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp TransactionResponse) {
+				want := "operation 1 (delete pkg/sub): path is a directory, not a file"
+				if resp.Error != want {
+					t.Errorf("got error %q, want %q", resp.Error, want)
+				}
+			},
+		},
+		{
+			name:   "move onto existing file",
+			method: http.MethodPost,
+			body: TransactionRequest{Operations: []TransactionOp{
+				{Op: TxOpMove, Path: "pkg/a.go", Destination: "pkg/b.go"},
+			}},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp TransactionResponse) {
+				if resp.FailedOp != 1 {
+					t.Errorf("got failed op %d, want 1", resp.FailedOp)
+				}
+			},
+		},
+		{
+			name:   "path outside root",
+			method: http.MethodPost,
+			body: TransactionRequest{Operations: []TransactionOp{
+				{Op: TxOpWrite, Path: "pkg/ok.go", Content: "x"},
+				{Op: TxOpWrite, Path: "/etc/evil", Content: "x"},
+			}},
+			wantStatus: http.StatusBadRequest,
+			verify: func(t *testing.T) {
+				if got := readFile("pkg/ok.go"); got != "<missing>" {
+					t.Errorf("ok.go should not be written, got %q", got)
+				}
+			},
+		},
+		{
+			name:       "no operations",
+			method:     http.MethodPost,
+			body:       TransactionRequest{},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp TransactionResponse) {
+				if resp.Error != "operations are required" {
+					t.Errorf("got error %q", resp.Error)
+				}
+			},
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodGet,
+			body:       nil,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset()
+
+			var body bytes.Buffer
+			if tt.body != nil {
+				json.NewEncoder(&body).Encode(tt.body)
+			}
+
+			req := httptest.NewRequest(tt.method, "/mcp/tool/file_scanner/transaction", &body)
+			rec := httptest.NewRecorder()
+
+			TransactionHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			if tt.checkResp != nil {
+				var resp TransactionResponse
+				json.NewDecoder(rec.Body).Decode(&resp)
+				tt.checkResp(t, resp)
+			}
+
+			if tt.verify != nil {
+				tt.verify(t)
+			}
+		})
+	}
+}
+
+func TestApplyChangesRollbackPurgesTrash(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	dead := filepath.Join(tmpDir, "dead.go")
+	file := filepath.Join(tmpDir, "a.go")
+	os.WriteFile(dead, []byte("package pkg\n"), 0644)
+	os.WriteFile(file, []byte("package pkg\n"), 0644)
+
+	// Writing under a file fails after the delete has gone to the trash
+	_, err := applyChanges([]fileutil.Change{
+		{Path: dead, Delete: true},
+		{Path: filepath.Join(file, "nested.go"), Content: []byte("x")},
+	}, "test")
+	if err == nil {
+		t.Fatal("expected the changeset to fail")
+	}
+	if got, _ := os.ReadFile(dead); string(got) != "package pkg\n" {
+		t.Errorf("dead.go should be restored, got %q", got)
+	}
+	if items, _ := trash.List(); len(items) != 0 {
+		t.Errorf("got %d trash items after rollback, want 0", len(items))
+	}
+}
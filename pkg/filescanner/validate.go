@@ -0,0 +1,115 @@
+package filescanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ValidateWarn   = "warn"   // report syntax errors but write anyway
+	ValidateStrict = "strict" // refuse to write content with syntax errors
+)
+
+// maxSyntaxErrors caps how many syntax errors are reported per file
+const maxSyntaxErrors = 10
+
+var errSyntax = errors.New("content has syntax errors; nothing was written")
+
+// SyntaxError locates a problem found while validating content. Line and
+// Column are 1-based.
+type SyntaxError struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+// checkContent validates content by the file type of path and, when format
+// is set, runs gofmt on Go source. Validation runs when validate is set or
+// format is requested; other file types pass through unchanged. In strict
+// mode syntax errors are returned with errSyntax.
+func checkContent(path string, content []byte, doFormat bool, validate string) ([]byte, []SyntaxError, error) {
+	switch validate {
+	case "", ValidateWarn, ValidateStrict:
+	default:
+		return nil, nil, errors.New("invalid validate: " + validate)
+	}
+	if !doFormat && validate == "" {
+		return content, nil, nil
+	}
+
+	var errs []SyntaxError
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".go":
+		errs = goSyntaxErrors(path, content)
+		if doFormat && len(errs) == 0 {
+			formatted, err := format.Source(content)
+			if err != nil {
+				return nil, nil, err
+			}
+			content = formatted
+		}
+	case ".json":
+		errs = jsonSyntaxErrors(path, content)
+	}
+
+	if len(errs) > 0 && validate == ValidateStrict {
+		return nil, errs, errSyntax
+	}
+	return content, errs, nil
+}
+
+func goSyntaxErrors(path string, content []byte) []SyntaxError {
+	_, err := parser.ParseFile(token.NewFileSet(), path, content, parser.AllErrors)
+	if err == nil {
+		return nil
+	}
+
+	var list scanner.ErrorList
+	if !errors.As(err, &list) {
+		return []SyntaxError{{File: path, Line: 1, Column: 1, Message: err.Error()}}
+	}
+
+	// Keep the first error per line; the rest are usually cascades of it
+	list.RemoveMultiples()
+
+	var errs []SyntaxError
+	for _, e := range list[:min(len(list), maxSyntaxErrors)] {
+		errs = append(errs, SyntaxError{File: path, Line: e.Pos.Line, Column: e.Pos.Column, Message: e.Msg})
+	}
+	return errs
+}
+
+func jsonSyntaxErrors(path string, content []byte) []SyntaxError {
+	var v any
+	err := json.Unmarshal(content, &v)
+	if err == nil {
+		return nil
+	}
+
+	var synErr *json.SyntaxError
+	if !errors.As(err, &synErr) {
+		return []SyntaxError{{File: path, Line: 1, Column: 1, Message: err.Error()}}
+	}
+
+	// Offset counts the bytes read before the error, so the bad byte is the
+	// one just before it
+	line, col := lineColumn(content, max(int(synErr.Offset)-1, 0))
+	return []SyntaxError{{File: path, Line: line, Column: col, Message: synErr.Error()}}
+}
+
+// lineColumn converts a byte offset in content to a 1-based line and column
+func lineColumn(content []byte, offset int) (int, int) {
+	offset = min(offset, len(content))
+	before := content[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := offset - (bytes.LastIndexByte(before, '\n') + 1) + 1
+	return line, col
+}
@@ -0,0 +1,153 @@
+package filescanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckContent(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		content    string
+		format     bool
+		validate   string
+		wantErr    error
+		wantOut    string
+		wantErrors []SyntaxError
+	}{
+		{
+			name:    "off by default",
+			path:    "main.go",
+			content: "package main\nfunc (",
+			wantOut: "package main\nfunc (",
+		},
+		{
+			name:    "format go",
+			path:    "main.go",
+			content: "package main\nfunc  main( ) {\nx:=1\n_ = x}\n",
+			format:  true,
+			wantOut: "package main\n\nfunc main() {\n\tx := 1\n\t_ = x\n}\n",
+		},
+		{
+			name:     "go error warns",
+			path:     "main.go",
+			content:  "package main\n\nfunc main() {\n\tx := \n}\n",
+			validate: ValidateWarn,
+			wantOut:  "package main\n\nfunc main() {\n\tx := \n}\n",
+			wantErrors: []SyntaxError{
+				{File: "main.go", Line: 5, Column: 1, Message: "expected operand, found '}'"},
+			},
+		},
+		{
+			name:     "go error strict",
+			path:     "main.go",
+			content:  "package main\nfunc (",
+			validate: ValidateStrict,
+			wantErr:  errSyntax,
+		},
+		{
+			name:     "json error position",
+			path:     "config.json",
+			content:  "{\n  \"a\": 1,\n  \"b\": }\n",
+			validate: ValidateWarn,
+			wantOut:  "{\n  \"a\": 1,\n  \"b\": }\n",
+			wantErrors: []SyntaxError{
+				{File: "config.json", Line: 3, Column: 8, Message: "invalid character '}' looking for beginning of value"},
+			},
+		},
+		{
+			name:     "valid json",
+			path:     "config.JSON",
+			content:  "[1, 2]",
+			validate: ValidateStrict,
+			wantOut:  "[1, 2]",
+		},
+		{
+			name:     "other types pass through",
+			path:     "notes.txt",
+			content:  "{ not json",
+			validate: ValidateStrict,
+			wantOut:  "{ not json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, errs, err := checkContent(tt.path, []byte(tt.content), tt.format, tt.validate)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if len(errs) == 0 {
+					t.Error("expected syntax errors with a strict failure")
+				}
+				return
+			}
+			if string(out) != tt.wantOut {
+				t.Errorf("got output %q, want %q", out, tt.wantOut)
+			}
+			if len(errs) != len(tt.wantErrors) {
+				t.Fatalf("got errors %+v, want %+v", errs, tt.wantErrors)
+			}
+			for i := range errs {
+				if errs[i] != tt.wantErrors[i] {
+					t.Errorf("error %d: got %+v, want %+v", i, errs[i], tt.wantErrors[i])
+				}
+			}
+		})
+	}
+
+	if _, _, err := checkContent("a.go", nil, false, "sometimes"); err == nil {
+		t.Error("expected error for invalid validate mode")
+	}
+}
+
+func TestValidateOnWrite(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	path := filepath.Join(tmpDir, "main.go")
+	os.WriteFile(path, []byte("package main\n\nfunc main() {}\n"), 0644)
+
+	post := func(handler http.HandlerFunc, body any, resp any) int {
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(body)
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/", &buf))
+		json.NewDecoder(rec.Body).Decode(resp)
+		return rec.Code
+	}
+
+	var write WriteResponse
+	code := post(WriteHandler, WriteRequest{Path: path, Content: "package main\nfunc main() {", Validate: ValidateStrict}, &write)
+	if code != http.StatusBadRequest || write.Error != errSyntax.Error() || len(write.SyntaxErrors) == 0 {
+		t.Errorf("strict write: got status %d, resp %+v", code, write)
+	}
+	if write.SyntaxErrors[0].File != path {
+		t.Errorf("got file %q, want %q", write.SyntaxErrors[0].File, path)
+	}
+
+	var edit EditResponse
+	code = post(EditHandler, EditRequest{Path: path, OldString: "func main() {}", NewString: "func main() {", Validate: ValidateStrict}, &edit)
+	if code != http.StatusBadRequest || len(edit.SyntaxErrors) == 0 {
+		t.Errorf("strict edit: got status %d, resp %+v", code, edit)
+	}
+
+	if got, _ := os.ReadFile(path); string(got) != "package main\n\nfunc main() {}\n" {
+		t.Errorf("refused writes changed the file: %q", got)
+	}
+
+	code = post(EditLinesHandler, EditLinesRequest{Path: path, Operation: LineOpReplace, StartLine: 3, EndLine: 3, Content: "func main()  {  }", Format: true}, &edit)
+	if code != http.StatusOK {
+		t.Fatalf("formatted edit: got status %d, error %q", code, edit.Error)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "package main\n\nfunc main() {}\n" {
+		t.Errorf("got content %q after format", got)
+	}
+}
@@ -0,0 +1,83 @@
+package filescanner
+
+import (
+	"bytes"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// ignoredDirs are skipped when walking a tree for search-style tools
+var ignoredDirs = map[string]bool{
+	".git":         true,
+	".engl":        true,
+	".hg":          true,
+	".svn":         true,
+	"node_modules": true,
+	"vendor":       true,
+}
+
+// binarySniffLen is how much of a file is inspected when deciding if it is binary
+const binarySniffLen = 8000
+
+// isBinary reports whether data looks like binary content (contains a NUL byte)
+func isBinary(data []byte) bool {
+	if len(data) > binarySniffLen {
+		data = data[:binarySniffLen]
+	}
+	return bytes.IndexByte(data, 0) != -1
+}
+
+// matchGlob reports whether the file at rel matches glob. Globs without a
+// separator match the base name, otherwise the path relative to the walk root.
+func matchGlob(glob, rel string) bool {
+	if glob == "" {
+		return true
+	}
+	rel = filepath.ToSlash(rel)
+	target := rel
+	if !strings.Contains(glob, "/") {
+		target = filepath.Base(rel)
+	}
+	ok, err := filepath.Match(glob, target)
+	return err == nil && ok
+}
+
+// collectFiles walks root and returns every regular file matching glob,
+// skipping ignored directories. Symlinks are not followed.
+func collectFiles(root, glob string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if path != root && ignoredDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		if path == root {
+			rel = d.Name()
+		}
+
+		if matchGlob(glob, rel) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,125 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Change is one file mutation in a changeset: either write Content to Path
+// or, when Delete is set, remove the file at Path. Perm applies to files that
+// do not exist yet; zero means 0644. Remove, if set, deletes the file in
+// place of os.Remove.
+type Change struct {
+	Path    string
+	Content []byte
+	Delete  bool
+	Perm    os.FileMode
+	Remove  func(path string) error
+}
+
+// snapshot records a path's state before a changeset touched it
+type snapshot struct {
+	path    string
+	existed bool
+	content []byte
+	mode    os.FileMode
+}
+
+// Apply performs changes in order. If any change fails, every change already
+// made is rolled back, including directories created along the way, so the
+// files are left as they were found.
+func Apply(changes []Change) error {
+	var done []snapshot
+	var createdDirs []string
+
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			s := done[i]
+			if s.existed {
+				WriteFile(s.path, s.content, s.mode)
+				os.Chmod(s.path, s.mode)
+			} else {
+				os.Remove(s.path)
+			}
+		}
+		for i := len(createdDirs) - 1; i >= 0; i-- {
+			os.Remove(createdDirs[i])
+		}
+	}
+
+	for _, c := range changes {
+		snap, err := takeSnapshot(c.Path)
+		if err != nil {
+			rollback()
+			return err
+		}
+
+		if c.Delete {
+			remove := c.Remove
+			if remove == nil {
+				remove = os.Remove
+			}
+			err = remove(c.Path)
+		} else {
+			var dirs []string
+			dirs, err = mkdirAll(filepath.Dir(c.Path))
+			createdDirs = append(createdDirs, dirs...)
+			if err == nil {
+				perm := c.Perm
+				if perm == 0 {
+					perm = 0644
+				}
+				err = WriteFile(c.Path, c.Content, perm)
+			}
+		}
+		if err != nil {
+			rollback()
+			return err
+		}
+		done = append(done, snap)
+	}
+
+	return nil
+}
+
+func takeSnapshot(path string) (snapshot, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return snapshot{path: path}, nil
+	}
+	if err != nil {
+		return snapshot{}, err
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return snapshot{}, err
+	}
+	return snapshot{path: path, existed: true, content: content, mode: info.Mode().Perm()}, nil
+}
+
+// mkdirAll is os.MkdirAll that also returns the directories it created,
+// outermost first
+func mkdirAll(dir string) ([]string, error) {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	var created []string
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := os.Mkdir(missing[i], 0755); err != nil && !os.IsExist(err) {
+			return created, err
+		}
+		created = append(created, missing[i])
+	}
+	return created, nil
+}
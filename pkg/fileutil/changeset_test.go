@@ -0,0 +1,41 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyRollsBack(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	existing := filepath.Join(tmpDir, "existing.txt")
+	doomed := filepath.Join(tmpDir, "doomed.txt")
+	os.WriteFile(existing, []byte("original"), 0600)
+	os.WriteFile(doomed, []byte("keep me"), 0644)
+
+	err := Apply([]Change{
+		{Path: existing, Content: []byte("changed")},
+		{Path: filepath.Join(tmpDir, "new", "dir", "file.txt"), Content: []byte("new")},
+		{Path: doomed, Delete: true},
+		// existing.txt is a file, so nothing can be created beneath it
+		{Path: filepath.Join(existing, "child.txt"), Content: []byte("boom")},
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	content, _ := os.ReadFile(existing)
+	if string(content) != "original" {
+		t.Errorf("got content %q, want %q", content, "original")
+	}
+	if info, _ := os.Stat(existing); info.Mode().Perm() != 0600 {
+		t.Errorf("got mode %v, want 0600", info.Mode().Perm())
+	}
+	if content, _ := os.ReadFile(doomed); string(content) != "keep me" {
+		t.Errorf("deleted file was not restored, got %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "new")); !os.IsNotExist(err) {
+		t.Error("created directories should have been removed")
+	}
+}
@@ -0,0 +1,58 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyTree(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	src := filepath.Join(tmpDir, "src")
+	os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	os.WriteFile(filepath.Join(src, "run.sh"), []byte("#!/bin/sh\n"), 0755)
+	os.WriteFile(filepath.Join(src, "sub", "a.txt"), []byte("a"), 0644)
+	os.Symlink("run.sh", filepath.Join(src, "link"))
+
+	dst := filepath.Join(tmpDir, "dst")
+	if err := CopyTree(src, dst); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if content, _ := os.ReadFile(filepath.Join(dst, "sub", "a.txt")); string(content) != "a" {
+		t.Errorf("got content %q, want %q", content, "a")
+	}
+	if info, _ := os.Stat(filepath.Join(dst, "run.sh")); info.Mode().Perm() != 0755 {
+		t.Errorf("got mode %v, want 0755", info.Mode().Perm())
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "link")); err != nil || link != "run.sh" {
+		t.Errorf("got link %q (%v), want %q", link, err, "run.sh")
+	}
+
+	// Copying onto an existing target fails without touching it
+	if err := CopyTree(filepath.Join(src, "sub"), filepath.Join(dst, "sub")); err == nil {
+		t.Error("expected error copying onto existing directory")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "sub", "a.txt")); err != nil {
+		t.Errorf("existing target was modified: %v", err)
+	}
+}
+
+func TestMove(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	src := filepath.Join(tmpDir, "a.txt")
+	dst := filepath.Join(tmpDir, "b.txt")
+	os.WriteFile(src, []byte("a"), 0644)
+
+	if err := Move(src, dst); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Error("source still exists after move")
+	}
+	if content, _ := os.ReadFile(dst); string(content) != "a" {
+		t.Errorf("got content %q, want %q", content, "a")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package fileutil
+
+import "os"
+
+// preserveOwner is a no-op where file ownership is not uid/gid based
+func preserveOwner(f *os.File, info os.FileInfo) {}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package fileutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// preserveOwner gives f the owner and group of info. It is best effort: an
+// unprivileged process can only keep ownership it already has.
+func preserveOwner(f *os.File, info os.FileInfo) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	f.Chown(int(stat.Uid), int(stat.Gid))
+}
@@ -0,0 +1,129 @@
+package fileutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrConflict      = errors.New("file has changed since it was read")
+	ErrHashDirectory = errors.New("expected_hash cannot be checked on a directory")
+)
+
+// Hash returns the hex encoded SHA-256 of data, the content hash used for
+// optimistic concurrency checks
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckVersion verifies that path still matches the hash and/or modification
+// time the caller last saw. Unset expectations are skipped. On mismatch it
+// returns ErrConflict along with the file's current hash, which is empty when
+// the file no longer exists.
+func CheckVersion(path, expectedHash string, expectedModTime *time.Time) (string, error) {
+	if expectedHash == "" && expectedModTime == nil {
+		return "", nil
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return "", ErrConflict
+	}
+	if err != nil {
+		return "", err
+	}
+
+	current := ""
+	if info.IsDir() {
+		if expectedHash != "" {
+			return "", ErrHashDirectory
+		}
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		current = Hash(data)
+	}
+
+	if expectedHash != "" && current != expectedHash {
+		return current, ErrConflict
+	}
+	if expectedModTime != nil && !info.ModTime().Equal(*expectedModTime) {
+		return current, ErrConflict
+	}
+	return current, nil
+}
+
+// heldPaths counts the holders of each locked path. Entries are removed on
+// unlock, so it only grows with the paths in use.
+var (
+	locksMu   sync.Mutex
+	locksFree = sync.NewCond(&locksMu)
+	heldPaths = map[string]int{}
+)
+
+// LockPath serializes mutations of a path within this process, so a version
+// check and the write that follows it cannot interleave with another request
+// for the same file. A path conflicts with its ancestors and descendants too,
+// so locking a directory covers everything under it. Call the returned
+// function to unlock.
+func LockPath(path string) func() {
+	return LockPaths([]string{path})
+}
+
+// LockPaths locks several paths at once. They are taken together once none
+// conflicts with a path held elsewhere, so two changesets touching
+// overlapping files cannot deadlock.
+func LockPaths(paths []string) func() {
+	cleaned := make([]string, len(paths))
+	for i, p := range paths {
+		cleaned[i] = filepath.Clean(p)
+	}
+
+	locksMu.Lock()
+	for conflictsHeld(cleaned) {
+		locksFree.Wait()
+	}
+	for _, p := range cleaned {
+		heldPaths[p]++
+	}
+	locksMu.Unlock()
+
+	return func() {
+		locksMu.Lock()
+		for _, p := range cleaned {
+			if heldPaths[p]--; heldPaths[p] == 0 {
+				delete(heldPaths, p)
+			}
+		}
+		locksMu.Unlock()
+		locksFree.Broadcast()
+	}
+}
+
+func conflictsHeld(paths []string) bool {
+	for held := range heldPaths {
+		for _, p := range paths {
+			if p == held || isUnder(held, p) || isUnder(p, held) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isUnder reports whether path is inside dir. Both must be clean.
+func isUnder(dir, path string) bool {
+	if !strings.HasPrefix(path, dir) || len(path) == len(dir) {
+		return false
+	}
+	return os.IsPathSeparator(dir[len(dir)-1]) || os.IsPathSeparator(path[len(dir)])
+}
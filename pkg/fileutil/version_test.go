@@ -0,0 +1,74 @@
+package fileutil
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockPaths(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "srv", "root")
+	dir := filepath.Join(root, "dir")
+	file := filepath.Join(dir, "a.txt")
+	sibling := filepath.Join(root, "dir2", "a.txt")
+
+	tests := []struct {
+		name     string
+		held     string
+		want     []string
+		conflict bool
+	}{
+		{name: "same path", held: file, want: []string{file}, conflict: true},
+		{name: "ancestor held", held: dir, want: []string{file}, conflict: true},
+		{name: "descendant held", held: file, want: []string{root}, conflict: true},
+		{name: "any of several", held: file, want: []string{sibling, dir}, conflict: true},
+		{name: "shared prefix only", held: dir, want: []string{sibling}},
+		{name: "unclean path", held: dir, want: []string{dir + "2/../dir2/b.txt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unlock := LockPath(tt.held)
+			acquired := make(chan func())
+			go func() { acquired <- LockPaths(tt.want) }()
+
+			select {
+			case u := <-acquired:
+				if tt.conflict {
+					t.Error("lock was taken while a conflicting path was held")
+				}
+				u()
+				unlock()
+				return
+			case <-time.After(50 * time.Millisecond):
+				if !tt.conflict {
+					t.Fatal("lock was blocked by an unrelated path")
+				}
+			}
+
+			unlock()
+			select {
+			case u := <-acquired:
+				u()
+			case <-time.After(time.Second):
+				t.Fatal("lock was not taken after the conflicting path was released")
+			}
+		})
+	}
+
+	if len(heldPaths) != 0 {
+		t.Errorf("lock table should be empty after unlocking, has %v", heldPaths)
+	}
+}
+
+func TestLockPathsOverlappingRequest(t *testing.T) {
+	// A request may name a directory and a file inside it, as a move onto a
+	// parent does
+	dir := filepath.Join(string(filepath.Separator), "srv", "root", "outer")
+	unlock := LockPaths([]string{filepath.Join(dir, "f.txt"), dir, dir})
+	unlock()
+
+	if len(heldPaths) != 0 {
+		t.Errorf("lock table should be empty after unlocking, has %v", heldPaths)
+	}
+}
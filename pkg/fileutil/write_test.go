@@ -0,0 +1,63 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	t.Run("creates new file with perm", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "new.txt")
+		if err := WriteFile(path, []byte("hello"), 0640); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		content, _ := os.ReadFile(path)
+		if string(content) != "hello" {
+			t.Errorf("got content %q, want %q", content, "hello")
+		}
+		info, _ := os.Stat(path)
+		if info.Mode().Perm() != 0640 {
+			t.Errorf("got mode %v, want 0640", info.Mode().Perm())
+		}
+	})
+
+	t.Run("preserves existing mode", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "script.sh")
+		os.WriteFile(path, []byte("old"), 0755)
+		os.Chmod(path, 0755)
+
+		if err := WriteFile(path, []byte("new"), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		content, _ := os.ReadFile(path)
+		if string(content) != "new" {
+			t.Errorf("got content %q, want %q", content, "new")
+		}
+		info, _ := os.Stat(path)
+		if info.Mode().Perm() != 0755 {
+			t.Errorf("got mode %v, want 0755", info.Mode().Perm())
+		}
+	})
+
+	t.Run("leaves no temp files behind", func(t *testing.T) {
+		dir := filepath.Join(tmpDir, "clean")
+		os.Mkdir(dir, 0755)
+		WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+		WriteFile(filepath.Join(dir, "a.txt"), []byte("b"), 0644)
+
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 1 {
+			t.Errorf("got %d entries, want 1", len(entries))
+		}
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		err := WriteFile(filepath.Join(tmpDir, "nope", "a.txt"), []byte("a"), 0644)
+		if err == nil {
+			t.Error("expected an error for missing directory")
+		}
+	})
+}
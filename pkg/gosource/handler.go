@@ -0,0 +1,343 @@
+package gosource
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/phillip-england/engl/pkg/pathutil"
+)
+
+var (
+	errNotGoFile = errors.New("not a .go file")
+	errNoGoFiles = errors.New("no .go files in directory")
+)
+
+type OutlineRequest struct {
+	Path string `json:"path"`
+}
+
+type Import struct {
+	Path string `json:"path"`
+	Name string `json:"name,omitempty"`
+	Line int    `json:"line"`
+}
+
+type Symbol struct {
+	Name      string   `json:"name"`
+	Kind      string   `json:"kind"`
+	Receiver  string   `json:"receiver,omitempty"`
+	Type      string   `json:"type,omitempty"`
+	Signature string   `json:"signature,omitempty"`
+	StartLine int      `json:"start_line"`
+	EndLine   int      `json:"end_line"`
+	Doc       string   `json:"doc,omitempty"`
+	Fields    []Symbol `json:"fields,omitempty"`
+}
+
+type FileOutline struct {
+	File    string   `json:"file"`
+	Package string   `json:"package"`
+	Imports []Import `json:"imports,omitempty"`
+	Symbols []Symbol `json:"symbols"`
+}
+
+type OutlineResponse struct {
+	Files []FileOutline `json:"files,omitempty"`
+	Error string        `json:"error,omitempty"`
+}
+
+// OutlineHandler returns the declarations of a Go file or package directory
+func OutlineHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req OutlineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOutlineError(w, "Invalid JSON body")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Path == "" {
+		writeOutlineError(w, "path is required")
+		return
+	}
+
+	validPath, err := pathutil.ValidatePath(req.Path)
+	if err != nil {
+		writeOutlineError(w, "access denied: "+err.Error())
+		return
+	}
+
+	log.Printf("HIT: %s | Path: %s", r.URL.Path, validPath)
+
+	files, err := goFiles(validPath)
+	if err != nil {
+		writeOutlineError(w, err.Error())
+		return
+	}
+
+	fset := token.NewFileSet()
+	outlines := make([]FileOutline, 0, len(files))
+	for _, file := range files {
+		outline, err := outlineFile(fset, file)
+		if err != nil {
+			writeOutlineError(w, err.Error())
+			return
+		}
+		outlines = append(outlines, outline)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OutlineResponse{Files: outlines})
+}
+
+// goFiles returns path itself if it is a file, or the .go files directly
+// inside it if it is a directory
+func goFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		if filepath.Ext(path) != ".go" {
+			return nil, errNotGoFile
+		}
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && filepath.Ext(e.Name()) == ".go" {
+			files = append(files, filepath.Join(path, e.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, errNoGoFiles
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func outlineFile(fset *token.FileSet, path string) (FileOutline, error) {
+	f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return FileOutline{}, err
+	}
+
+	outline := FileOutline{
+		File:    path,
+		Package: f.Name.Name,
+		Symbols: []Symbol{},
+	}
+
+	for _, imp := range f.Imports {
+		i := Import{
+			Path: strings.Trim(imp.Path.Value, "\"`"),
+			Line: fset.Position(imp.Pos()).Line,
+		}
+		if imp.Name != nil {
+			i.Name = imp.Name.Name
+		}
+		outline.Imports = append(outline.Imports, i)
+	}
+
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			outline.Symbols = append(outline.Symbols, funcSymbol(fset, d))
+		case *ast.GenDecl:
+			outline.Symbols = append(outline.Symbols, genDeclSymbols(fset, d)...)
+		}
+	}
+
+	return outline, nil
+}
+
+func funcSymbol(fset *token.FileSet, d *ast.FuncDecl) Symbol {
+	sym := Symbol{
+		Name: d.Name.Name,
+		Kind: "func",
+		Doc:  docText(d.Doc),
+	}
+	sym.StartLine, sym.EndLine = lineRange(fset, d)
+
+	if d.Recv != nil && len(d.Recv.List) > 0 {
+		sym.Kind = "method"
+		sym.Receiver = nodeString(fset, d.Recv.List[0].Type)
+	}
+
+	// Print the declaration without its body or doc to get the signature
+	sig := *d
+	sig.Body = nil
+	sig.Doc = nil
+	sym.Signature = nodeString(fset, &sig)
+
+	return sym
+}
+
+func genDeclSymbols(fset *token.FileSet, d *ast.GenDecl) []Symbol {
+	var symbols []Symbol
+
+	for _, spec := range d.Specs {
+		switch s := spec.(type) {
+		case *ast.TypeSpec:
+			sym := Symbol{
+				Name: s.Name.Name,
+				Kind: typeKind(s),
+				Doc:  specDoc(d, s.Doc, s.Comment),
+			}
+			sym.StartLine, sym.EndLine = lineRange(fset, s)
+			if len(d.Specs) == 1 {
+				sym.StartLine, _ = lineRange(fset, d)
+			}
+			switch t := s.Type.(type) {
+			case *ast.StructType:
+				sym.Fields = fieldSymbols(fset, t.Fields, "field")
+			case *ast.InterfaceType:
+				sym.Fields = fieldSymbols(fset, t.Methods, "method")
+			default:
+				sym.Type = nodeString(fset, s.Type)
+			}
+			symbols = append(symbols, sym)
+
+		case *ast.ValueSpec:
+			start, end := lineRange(fset, s)
+			for _, name := range s.Names {
+				if name.Name == "_" {
+					continue
+				}
+				sym := Symbol{
+					Name:      name.Name,
+					Kind:      d.Tok.String(),
+					Doc:       specDoc(d, s.Doc, s.Comment),
+					StartLine: start,
+					EndLine:   end,
+				}
+				if s.Type != nil {
+					sym.Type = nodeString(fset, s.Type)
+				}
+				symbols = append(symbols, sym)
+			}
+		}
+	}
+
+	return symbols
+}
+
+func fieldSymbols(fset *token.FileSet, fields *ast.FieldList, kind string) []Symbol {
+	if fields == nil {
+		return nil
+	}
+
+	var symbols []Symbol
+	for _, field := range fields.List {
+		start, end := lineRange(fset, field)
+		doc := docText(field.Doc)
+		if doc == "" {
+			doc = docText(field.Comment)
+		}
+		typ := nodeString(fset, field.Type)
+
+		// Embedded fields have no names; report them by their type
+		if len(field.Names) == 0 {
+			symbols = append(symbols, Symbol{
+				Name:      typ,
+				Kind:      "embedded",
+				Type:      typ,
+				StartLine: start,
+				EndLine:   end,
+				Doc:       doc,
+			})
+			continue
+		}
+
+		for _, name := range field.Names {
+			sym := Symbol{
+				Name:      name.Name,
+				Kind:      kind,
+				StartLine: start,
+				EndLine:   end,
+				Doc:       doc,
+			}
+			if kind == "method" {
+				sym.Signature = name.Name + strings.TrimPrefix(typ, "func")
+			} else {
+				sym.Type = typ
+			}
+			symbols = append(symbols, sym)
+		}
+	}
+	return symbols
+}
+
+func typeKind(s *ast.TypeSpec) string {
+	if s.Assign.IsValid() {
+		return "alias"
+	}
+	switch s.Type.(type) {
+	case *ast.StructType:
+		return "struct"
+	case *ast.InterfaceType:
+		return "interface"
+	}
+	return "type"
+}
+
+// specDoc prefers the spec's own doc, falling back to the enclosing
+// declaration's doc for ungrouped declarations and then the line comment
+func specDoc(d *ast.GenDecl, doc, comment *ast.CommentGroup) string {
+	if text := docText(doc); text != "" {
+		return text
+	}
+	if !d.Lparen.IsValid() {
+		if text := docText(d.Doc); text != "" {
+			return text
+		}
+	}
+	return docText(comment)
+}
+
+func docText(cg *ast.CommentGroup) string {
+	if cg == nil {
+		return ""
+	}
+	return strings.TrimSpace(cg.Text())
+}
+
+func lineRange(fset *token.FileSet, n ast.Node) (int, int) {
+	return fset.Position(n.Pos()).Line, fset.Position(n.End()).Line
+}
+
+func nodeString(fset *token.FileSet, n any) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, n); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+func writeOutlineError(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(OutlineResponse{Error: msg})
+}
@@ -0,0 +1,236 @@
+package gosource
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/phillip-england/engl/pkg/pathutil"
+)
+
+func withAllowedRoot(t *testing.T, root string) func() {
+	old := pathutil.GetAllowedRoot()
+	pathutil.SetAllowedRoot(root)
+	return func() {
+		pathutil.SetAllowedRoot(old)
+	}
+}
+
+const sampleSource = `// Package sample is for tests.
+package sample
+
+import (
+	"fmt"
+	str "strings"
+)
+
+// MaxSize limits things.
+const MaxSize = 10
+
+var (
+	count int
+	name  = "x" // the name
+)
+
+// Server serves.
+type Server struct {
+	// Addr is the listen address.
+	Addr string
+	io.Writer
+	port, backlog int
+}
+
+type Runner interface {
+	Run(ctx string) error
+}
+
+type ID = string
+
+// Start starts the server.
+func (s *Server) Start() error {
+	fmt.Println(str.ToUpper(s.Addr))
+	return nil
+}
+
+func helper(a, b int) int {
+	return a + b
+}
+`
+
+func findSymbol(symbols []Symbol, name string) *Symbol {
+	for i := range symbols {
+		if symbols[i].Name == name {
+			return &symbols[i]
+		}
+	}
+	return nil
+}
+
+func TestOutlineHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	pkgDir := filepath.Join(tmpDir, "sample")
+	os.Mkdir(pkgDir, 0755)
+	os.WriteFile(filepath.Join(pkgDir, "sample.go"), []byte(sampleSource), 0644)
+	os.WriteFile(filepath.Join(pkgDir, "extra.go"), []byte("package sample\n\nfunc Extra() {}\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "broken.go"), []byte("package broken\n\nfunc {\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "notes.txt"), []byte("hi"), 0644)
+
+	tests := []struct {
+		name       string
+		method     string
+		body       any
+		wantStatus int
+		checkResp  func(*testing.T, OutlineResponse)
+	}{
+		{
+			name:       "single file",
+			method:     http.MethodPost,
+			body:       OutlineRequest{Path: filepath.Join(pkgDir, "sample.go")},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp OutlineResponse) {
+				if resp.Error != "" {
+					t.Fatalf("unexpected error: %s", resp.Error)
+				}
+				if len(resp.Files) != 1 {
+					t.Fatalf("got %d files, want 1", len(resp.Files))
+				}
+				f := resp.Files[0]
+				if f.Package != "sample" {
+					t.Errorf("got package %q, want sample", f.Package)
+				}
+				if len(f.Imports) != 2 || f.Imports[1].Name != "str" || f.Imports[1].Path != "strings" {
+					t.Errorf("unexpected imports: %+v", f.Imports)
+				}
+
+				if s := findSymbol(f.Symbols, "MaxSize"); s == nil || s.Kind != "const" || s.Doc != "MaxSize limits things." {
+					t.Errorf("unexpected MaxSize: %+v", s)
+				}
+				if s := findSymbol(f.Symbols, "name"); s == nil || s.Kind != "var" || s.Doc != "the name" {
+					t.Errorf("unexpected name: %+v", s)
+				}
+				if s := findSymbol(f.Symbols, "ID"); s == nil || s.Kind != "alias" || s.Type != "string" {
+					t.Errorf("unexpected ID: %+v", s)
+				}
+				if s := findSymbol(f.Symbols, "Runner"); s == nil || s.Kind != "interface" || len(s.Fields) != 1 || s.Fields[0].Signature != "Run(ctx string) error" {
+					t.Errorf("unexpected Runner: %+v", s)
+				}
+
+				server := findSymbol(f.Symbols, "Server")
+				if server == nil || server.Kind != "struct" {
+					t.Fatalf("unexpected Server: %+v", server)
+				}
+				if server.StartLine != 18 || server.EndLine != 23 {
+					t.Errorf("got Server lines %d-%d, want 18-23", server.StartLine, server.EndLine)
+				}
+				if len(server.Fields) != 4 {
+					t.Fatalf("got %d fields, want 4", len(server.Fields))
+				}
+				if server.Fields[0].Name != "Addr" || server.Fields[0].Doc != "Addr is the listen address." {
+					t.Errorf("unexpected Addr field: %+v", server.Fields[0])
+				}
+				if server.Fields[1].Kind != "embedded" || server.Fields[1].Name != "io.Writer" {
+					t.Errorf("unexpected embedded field: %+v", server.Fields[1])
+				}
+
+				start := findSymbol(f.Symbols, "Start")
+				if start == nil || start.Kind != "method" || start.Receiver != "*Server" {
+					t.Fatalf("unexpected Start: %+v", start)
+				}
+				if start.Signature != "func (s *Server) Start() error" {
+					t.Errorf("got signature %q", start.Signature)
+				}
+				if start.StartLine != 32 || start.EndLine != 35 {
+					t.Errorf("got Start lines %d-%d, want 32-35", start.StartLine, start.EndLine)
+				}
+
+				if s := findSymbol(f.Symbols, "helper"); s == nil || s.Kind != "func" || s.Receiver != "" {
+					t.Errorf("unexpected helper: %+v", s)
+				}
+			},
+		},
+		{
+			name:       "package directory",
+			method:     http.MethodPost,
+			body:       OutlineRequest{Path: pkgDir},
+			wantStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp OutlineResponse) {
+				if len(resp.Files) != 2 {
+					t.Fatalf("got %d files, want 2", len(resp.Files))
+				}
+				if filepath.Base(resp.Files[0].File) != "extra.go" {
+					t.Errorf("got first file %s, want extra.go", resp.Files[0].File)
+				}
+			},
+		},
+		{
+			name:       "syntax error",
+			method:     http.MethodPost,
+			body:       OutlineRequest{Path: filepath.Join(tmpDir, "broken.go")},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp OutlineResponse) {
+				if resp.Error == "" {
+					t.Error("expected a parse error")
+				}
+			},
+		},
+		{
+			name:       "not a go file",
+			method:     http.MethodPost,
+			body:       OutlineRequest{Path: filepath.Join(tmpDir, "notes.txt")},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp OutlineResponse) {
+				if resp.Error != errNotGoFile.Error() {
+					t.Errorf("got error %q, want %q", resp.Error, errNotGoFile.Error())
+				}
+			},
+		},
+		{
+			name:       "missing path",
+			method:     http.MethodPost,
+			body:       OutlineRequest{},
+			wantStatus: http.StatusBadRequest,
+			checkResp: func(t *testing.T, resp OutlineResponse) {
+				if resp.Error != "path is required" {
+					t.Errorf("got error %q, want %q", resp.Error, "path is required")
+				}
+			},
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodGet,
+			body:       nil,
+			wantStatus: http.StatusMethodNotAllowed,
+			checkResp:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			if tt.body != nil {
+				json.NewEncoder(&body).Encode(tt.body)
+			}
+
+			req := httptest.NewRequest(tt.method, "/mcp/tool/go_source/outline", &body)
+			rec := httptest.NewRecorder()
+
+			OutlineHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			if tt.checkResp != nil {
+				var resp OutlineResponse
+				json.NewDecoder(rec.Body).Decode(&resp)
+				tt.checkResp(t, resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package history
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/phillip-england/engl/pkg/fileutil"
+	"github.com/phillip-england/engl/pkg/pathutil"
+	"github.com/phillip-england/engl/pkg/quota"
+)
+
+type ListRequest struct {
+	Path string `json:"path"`
+}
+
+type ListResponse struct {
+	Versions []Entry `json:"versions"`
+	Error    string  `json:"error,omitempty"`
+}
+
+type ReadRequest struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
+type ReadResponse struct {
+	Content string `json:"content,omitempty"`
+	Version *Entry `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type RestoreRequest struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
+type RestoreResponse struct {
+	Success bool   `json:"success"`
+	Hash    string `json:"hash,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ListHandler lists the recorded versions of a file, newest first
+func ListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeListError(w, "Invalid JSON body")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Path == "" {
+		writeListError(w, "path is required")
+		return
+	}
+
+	validPath, err := pathutil.ValidatePath(req.Path)
+	if err != nil {
+		writeListError(w, "access denied: "+err.Error())
+		return
+	}
+
+	log.Printf("HIT: %s | Path: %s", r.URL.Path, validPath)
+
+	entries, err := List(validPath)
+	if err != nil {
+		writeListError(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListResponse{Versions: entries})
+}
+
+// ReadHandler returns the content of a previous version of a file
+func ReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeReadError(w, "Invalid JSON body")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Path == "" || req.Hash == "" {
+		writeReadError(w, "path and hash are required")
+		return
+	}
+
+	validPath, err := pathutil.ValidatePath(req.Path)
+	if err != nil {
+		writeReadError(w, "access denied: "+err.Error())
+		return
+	}
+
+	log.Printf("HIT: %s | Path: %s | Hash: %s", r.URL.Path, validPath, req.Hash)
+
+	// Looking the hash up in this file's history keeps callers from reading
+	// objects that belong to other files
+	entry, err := Find(validPath, req.Hash)
+	if err != nil {
+		writeReadError(w, err.Error())
+		return
+	}
+
+	content, err := Read(entry.Hash)
+	if err != nil {
+		writeReadError(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ReadResponse{Content: string(content), Version: &entry})
+}
+
+// RestoreHandler puts a previous version of a file back in place. The
+// current content is snapshotted first, so a restore can itself be undone.
+func RestoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RestoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeRestoreError(w, "Invalid JSON body")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Path == "" || req.Hash == "" {
+		writeRestoreError(w, "path and hash are required")
+		return
+	}
+
+	validPath, err := pathutil.ValidateWritePath(req.Path)
+	if err != nil {
+		writeRestoreError(w, "access denied: "+err.Error())
+		return
+	}
+
+	log.Printf("HIT: %s | Path: %s | Hash: %s", r.URL.Path, validPath, req.Hash)
+
+	unlock := fileutil.LockPath(validPath)
+	defer unlock()
+
+	entry, err := Find(validPath, req.Hash)
+	if err != nil {
+		writeRestoreError(w, err.Error())
+		return
+	}
+
+	content, err := Read(entry.Hash)
+	if err != nil {
+		writeRestoreError(w, err.Error())
+		return
+	}
+
+	charge, err := quota.Check(quota.Change{Path: validPath, Size: int64(len(content))})
+	if err != nil {
+		writeRestoreError(w, err.Error())
+		return
+	}
+	defer charge.Release()
+
+	if err := Snapshot(validPath, "restore"); err != nil {
+		writeRestoreError(w, "history snapshot failed: "+err.Error())
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(validPath), 0755); err != nil {
+		writeRestoreError(w, err.Error())
+		return
+	}
+
+	if err := fileutil.WriteFile(validPath, content, entry.Mode); err != nil {
+		writeRestoreError(w, err.Error())
+		return
+	}
+	charge.Commit()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RestoreResponse{Success: true, Hash: entry.Hash})
+}
+
+func writeListError(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(ListResponse{Error: msg})
+}
+
+func writeReadError(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(ReadResponse{Error: msg})
+}
+
+func writeRestoreError(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(RestoreResponse{Error: msg})
+}
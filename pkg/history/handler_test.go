@@ -0,0 +1,156 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/phillip-england/engl/pkg/fileutil"
+)
+
+func TestListHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	path := filepath.Join(tmpDir, "a.txt")
+	os.WriteFile(path, []byte("v1"), 0644)
+	Snapshot(path, "write")
+
+	tests := []struct {
+		name       string
+		method     string
+		body       any
+		wantStatus int
+		wantCount  int
+		wantErr    string
+	}{
+		{name: "versions", method: http.MethodPost, body: ListRequest{Path: path}, wantStatus: http.StatusOK, wantCount: 1},
+		{name: "no history", method: http.MethodPost, body: ListRequest{Path: filepath.Join(tmpDir, "b.txt")}, wantStatus: http.StatusOK},
+		{name: "missing path", method: http.MethodPost, body: ListRequest{}, wantStatus: http.StatusBadRequest, wantErr: "path is required"},
+		{name: "outside root", method: http.MethodPost, body: ListRequest{Path: "/etc/passwd"}, wantStatus: http.StatusBadRequest},
+		{name: "wrong method", method: http.MethodGet, wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.body)
+			req := httptest.NewRequest(tt.method, "/mcp/tool/history/list", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+
+			ListHandler(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusMethodNotAllowed {
+				return
+			}
+
+			var resp ListResponse
+			json.NewDecoder(w.Body).Decode(&resp)
+			if tt.wantErr != "" && resp.Error != tt.wantErr {
+				t.Errorf("got error %q, want %q", resp.Error, tt.wantErr)
+			}
+			if len(resp.Versions) != tt.wantCount {
+				t.Errorf("got %d versions, want %d", len(resp.Versions), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestReadHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	a := filepath.Join(tmpDir, "a.txt")
+	b := filepath.Join(tmpDir, "b.txt")
+	os.WriteFile(a, []byte("v1"), 0644)
+	os.WriteFile(b, []byte("other"), 0644)
+	Snapshot(a, "write")
+	Snapshot(b, "write")
+
+	tests := []struct {
+		name        string
+		body        ReadRequest
+		wantStatus  int
+		wantContent string
+	}{
+		{name: "version", body: ReadRequest{Path: a, Hash: fileutil.Hash([]byte("v1"))}, wantStatus: http.StatusOK, wantContent: "v1"},
+		{name: "hash from another file", body: ReadRequest{Path: a, Hash: fileutil.Hash([]byte("other"))}, wantStatus: http.StatusBadRequest},
+		{name: "missing hash", body: ReadRequest{Path: a}, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.body)
+			req := httptest.NewRequest(http.MethodPost, "/mcp/tool/history/read", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+
+			ReadHandler(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			var resp ReadResponse
+			json.NewDecoder(w.Body).Decode(&resp)
+			if resp.Content != tt.wantContent {
+				t.Errorf("got content %q, want %q", resp.Content, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestRestoreHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	path := filepath.Join(tmpDir, "a.txt")
+	os.WriteFile(path, []byte("v1"), 0640)
+	Snapshot(path, "delete")
+	os.Remove(path)
+
+	restore := func(hash string) (int, RestoreResponse) {
+		body, _ := json.Marshal(RestoreRequest{Path: path, Hash: hash})
+		req := httptest.NewRequest(http.MethodPost, "/mcp/tool/history/restore", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		RestoreHandler(w, req)
+		var resp RestoreResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	// A deleted file comes back with its old mode
+	v1 := fileutil.Hash([]byte("v1"))
+	if code, resp := restore(v1); code != http.StatusOK || !resp.Success {
+		t.Fatalf("restore deleted file: status %d, resp %+v", code, resp)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("got mode %o, want 640", info.Mode().Perm())
+	}
+
+	// Restoring over existing content records that content first
+	os.WriteFile(path, []byte("v2"), 0640)
+	if code, _ := restore(v1); code != http.StatusOK {
+		t.Fatalf("restore: status %d", code)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "v1" {
+		t.Errorf("got content %q, want %q", got, "v1")
+	}
+	entries, _ := List(path)
+	if len(entries) != 2 || entries[0].Op != "restore" || entries[0].Hash != fileutil.Hash([]byte("v2")) {
+		t.Errorf("got entries %+v, want restore snapshot of v2 first", entries)
+	}
+
+	if code, resp := restore("0000"); code != http.StatusBadRequest || resp.Error != ErrNotFound.Error() {
+		t.Errorf("unknown hash: status %d, resp %+v", code, resp)
+	}
+}
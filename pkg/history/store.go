@@ -0,0 +1,217 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/phillip-england/engl/pkg/fileutil"
+	"github.com/phillip-england/engl/pkg/pathutil"
+)
+
+// maxSnapshotSize caps the size of a single file kept in history
+const maxSnapshotSize = 10 << 20
+
+var (
+	ErrNotFound = errors.New("version not found in history")
+)
+
+var mu sync.Mutex
+
+// Entry records one version of a file, captured just before a mutation
+type Entry struct {
+	Path string      `json:"path"`
+	Hash string      `json:"hash"`
+	Size int64       `json:"size"`
+	Mode os.FileMode `json:"mode"`
+	Op   string      `json:"op"`
+	Time time.Time   `json:"time"`
+}
+
+func objectPath(hash string) string {
+	return filepath.Join(pathutil.StateDir(), "history", "objects", hash[:2], hash)
+}
+
+func indexPath(rel string) string {
+	return filepath.Join(pathutil.StateDir(), "history", "index", fileutil.Hash([]byte(rel))+".jsonl")
+}
+
+// relPath returns the key history uses for path: its location relative to
+// the allowed root
+func relPath(path string) string {
+	rel, err := filepath.Rel(pathutil.GetAllowedRoot(), path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Snapshot stores the current content of path before op mutates it. A
+// directory snapshots every file beneath it. Missing paths, files inside the
+// state directory and files over the size cap are skipped.
+func Snapshot(path, op string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return snapshotFile(path, info, op)
+	}
+
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p == pathutil.StateDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return snapshotFile(p, info, op)
+	})
+}
+
+func snapshotFile(path string, info os.FileInfo, op string) error {
+	if !info.Mode().IsRegular() || info.Size() > maxSnapshotSize {
+		return nil
+	}
+	if rel, err := filepath.Rel(pathutil.StateDir(), path); err == nil && filepath.IsLocal(rel) {
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	entry := Entry{
+		Path: relPath(path),
+		Hash: fileutil.Hash(content),
+		Size: int64(len(content)),
+		Mode: info.Mode().Perm(),
+		Op:   op,
+		Time: time.Now().UTC(),
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	obj := objectPath(entry.Hash)
+	if _, err := os.Stat(obj); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(obj), 0755); err != nil {
+			return err
+		}
+		if err := fileutil.WriteFile(obj, content, 0644); err != nil {
+			return err
+		}
+	}
+
+	return appendEntry(entry)
+}
+
+func appendEntry(entry Entry) error {
+	idx := indexPath(entry.Path)
+	if err := os.MkdirAll(filepath.Dir(idx), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(idx, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// List returns the recorded versions of path, newest first
+func List(path string) ([]Entry, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	f, err := os.Open(indexPath(relPath(path)))
+	if os.IsNotExist(err) {
+		return []Entry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// Find returns the newest entry for path with the given hash
+func Find(path, hash string) (Entry, error) {
+	entries, err := List(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, e := range entries {
+		if e.Hash == hash {
+			return e, nil
+		}
+	}
+	return Entry{}, ErrNotFound
+}
+
+// Read returns the stored content for hash
+func Read(hash string) ([]byte, error) {
+	if len(hash) < 2 || !isHex(hash) {
+		return nil, ErrNotFound
+	}
+	content, err := os.ReadFile(objectPath(hash))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return content, err
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
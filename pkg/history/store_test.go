@@ -0,0 +1,104 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/phillip-england/engl/pkg/fileutil"
+	"github.com/phillip-england/engl/pkg/pathutil"
+)
+
+func withAllowedRoot(t *testing.T, root string) func() {
+	old := pathutil.GetAllowedRoot()
+	pathutil.SetAllowedRoot(root)
+	return func() {
+		pathutil.SetAllowedRoot(old)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	path := filepath.Join(tmpDir, "a.txt")
+
+	// Nothing to record before the file exists
+	if err := Snapshot(path, "write"); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := List(path); len(entries) != 0 {
+		t.Fatalf("got %d entries for missing file, want 0", len(entries))
+	}
+
+	os.WriteFile(path, []byte("one\n"), 0600)
+	if err := Snapshot(path, "write"); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, []byte("two\n"), 0600)
+	if err := Snapshot(path, "edit"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := List(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if entries[0].Op != "edit" || entries[0].Hash != fileutil.Hash([]byte("two\n")) {
+		t.Errorf("newest entry = %+v, want edit of \"two\"", entries[0])
+	}
+	if entries[1].Path != "a.txt" || entries[1].Mode != 0600 || entries[1].Size != 4 {
+		t.Errorf("oldest entry = %+v", entries[1])
+	}
+
+	content, err := Read(entries[1].Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "one\n" {
+		t.Errorf("got content %q, want %q", content, "one\n")
+	}
+
+	if _, err := Find(path, "deadbeef"); err != ErrNotFound {
+		t.Errorf("Find unknown hash: got %v, want ErrNotFound", err)
+	}
+	if _, err := Read("../../etc/passwd"); err != ErrNotFound {
+		t.Errorf("Read bad hash: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestSnapshotDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	dir := filepath.Join(tmpDir, "pkg")
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	os.WriteFile(filepath.Join(dir, "a.go"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(dir, "sub", "b.go"), []byte("b"), 0644)
+
+	if err := Snapshot(dir, "delete"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a.go", filepath.Join("sub", "b.go")} {
+		entries, err := List(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Op != "delete" {
+			t.Errorf("%s: got %+v, want one delete entry", name, entries)
+		}
+	}
+
+	// Snapshotting the root must not record the history store itself
+	if err := Snapshot(tmpDir, "delete"); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := List(filepath.Join(dir, "a.go"))
+	if len(entries) != 2 {
+		t.Errorf("got %d entries for a.go, want 2", len(entries))
+	}
+}
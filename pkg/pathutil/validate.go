@@ -10,9 +10,16 @@ import (
 var (
 	ErrPathOutsideRoot = errors.New("path is outside allowed directory")
 	ErrInvalidPath     = errors.New("invalid path")
+	ErrStateDir        = errors.New("path overlaps the server state directory")
 )
 
-var allowedRoot string
+// StateDirName is the default state directory, created inside the allowed root
+const StateDirName = ".engl"
+
+var (
+	allowedRoot string
+	stateDir    string
+)
 
 func init() {
 	cwd, err := os.Getwd()
@@ -20,6 +27,7 @@ func init() {
 		panic("failed to get working directory: " + err.Error())
 	}
 	allowedRoot = cwd
+	stateDir = os.Getenv("ENGL_STATE_DIR")
 }
 
 // GetAllowedRoot returns the allowed root directory
@@ -32,6 +40,25 @@ func SetAllowedRoot(path string) {
 	allowedRoot = path
 }
 
+// StateDir returns the absolute directory holding server state such as
+// history and trash. It defaults to .engl inside the allowed root and can be
+// set with ENGL_STATE_DIR; a relative value is taken from the allowed root.
+func StateDir() string {
+	switch {
+	case stateDir == "":
+		return filepath.Join(allowedRoot, StateDirName)
+	case filepath.IsAbs(stateDir):
+		return filepath.Clean(stateDir)
+	default:
+		return filepath.Join(allowedRoot, stateDir)
+	}
+}
+
+// SetStateDir sets the state directory (for testing)
+func SetStateDir(path string) {
+	stateDir = path
+}
+
 // ValidatePath checks if the given path is within the allowed root directory.
 // It resolves the path to absolute, evaluates symlinks, and ensures it doesn't escape.
 func ValidatePath(path string) (string, error) {
@@ -65,6 +92,36 @@ func ValidatePath(path string) (string, error) {
 	return realPath, nil
 }
 
+// ValidateWritePath is ValidatePath for tools that change the filesystem.
+// It also refuses the state directory, anything inside it and its parents,
+// so history and trash are only ever changed by the server itself.
+func ValidateWritePath(path string) (string, error) {
+	validPath, err := ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+	if OverlapsStateDir(validPath) {
+		return "", ErrStateDir
+	}
+	return validPath, nil
+}
+
+// OverlapsStateDir reports whether path is the state directory, lies inside
+// it or contains it
+func OverlapsStateDir(path string) bool {
+	state := filepath.Clean(StateDir())
+	if realState, err := filepath.EvalSymlinks(state); err == nil {
+		state = realState
+	}
+	return within(path, state) || within(state, path)
+}
+
+// within reports whether path is dir or lies beneath it
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && filepath.IsLocal(rel)
+}
+
 // validateNonExistentPath validates a path that doesn't exist yet (for write operations)
 func validateNonExistentPath(absPath string) (string, error) {
 	// Walk up the path until we find an existing directory
@@ -0,0 +1,86 @@
+package pathutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateWritePath(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldRoot, oldState := GetAllowedRoot(), stateDir
+	SetAllowedRoot(tmpDir)
+	SetStateDir("")
+	defer func() {
+		SetAllowedRoot(oldRoot)
+		SetStateDir(oldState)
+	}()
+
+	os.MkdirAll(filepath.Join(tmpDir, StateDirName, "trash"), 0755)
+	os.Mkdir(filepath.Join(tmpDir, "src"), 0755)
+
+	tests := []struct {
+		path    string
+		wantErr error
+	}{
+		{path: "src/main.go"},
+		{path: ".englx/file"},
+		{path: ".engl", wantErr: ErrStateDir},
+		{path: ".engl/trash/x/meta.json", wantErr: ErrStateDir},
+		{path: "src/../.engl/history", wantErr: ErrStateDir},
+		{path: ".", wantErr: ErrStateDir},
+		{path: "../outside", wantErr: ErrPathOutsideRoot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			_, err := ValidateWritePath(tt.path)
+			if err != tt.wantErr {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+			if _, err := ValidatePath(tt.path); tt.wantErr == ErrStateDir && err != nil {
+				t.Errorf("reads should still be allowed: %v", err)
+			}
+		})
+	}
+}
+
+func TestOverlapsStateDirCustom(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldState := stateDir
+	SetStateDir(filepath.Join(tmpDir, "state"))
+	defer SetStateDir(oldState)
+
+	for path, want := range map[string]bool{
+		filepath.Join(tmpDir, "state"):          true,
+		filepath.Join(tmpDir, "state", "trash"): true,
+		tmpDir:                                  true,
+		filepath.Join(tmpDir, "stateful"):       false,
+		filepath.Join(tmpDir, "other"):          false,
+	} {
+		if got := OverlapsStateDir(path); got != want {
+			t.Errorf("OverlapsStateDir(%s) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestStateDirRelative(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldRoot, oldState := GetAllowedRoot(), stateDir
+	SetAllowedRoot(tmpDir)
+	SetStateDir(".state")
+	defer func() {
+		SetAllowedRoot(oldRoot)
+		SetStateDir(oldState)
+	}()
+
+	if got, want := StateDir(), filepath.Join(tmpDir, ".state"); got != want {
+		t.Errorf("StateDir() = %s, want %s", got, want)
+	}
+	os.MkdirAll(filepath.Join(tmpDir, ".state", "history"), 0755)
+	for _, path := range []string{".state", ".state/history/x", "."} {
+		if _, err := ValidateWritePath(path); err != ErrStateDir {
+			t.Errorf("ValidateWritePath(%s) = %v, want %v", path, err, ErrStateDir)
+		}
+	}
+}
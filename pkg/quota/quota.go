@@ -0,0 +1,236 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phillip-england/engl/pkg/pathutil"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// usageTTL is how long a measured disk usage is trusted before the root is
+// walked again. Changes in between are tracked as deltas.
+const usageTTL = 30 * time.Second
+
+// Limits caps how much the tools may write. Zero disables a limit.
+// MaxSessionBytes counts every byte written since the server started;
+// MaxRootBytes caps disk usage under the allowed root, including history and
+// trash when the server state directory lies inside it.
+type Limits struct {
+	MaxWriteBytes   int64
+	MaxSessionBytes int64
+	MaxRootBytes    int64
+}
+
+// DefaultLimits apply unless overridden by ENGL_MAX_WRITE_BYTES,
+// ENGL_MAX_SESSION_BYTES and ENGL_MAX_ROOT_BYTES
+var DefaultLimits = Limits{
+	MaxWriteBytes:   10 << 20,
+	MaxSessionBytes: 1 << 30,
+}
+
+var (
+	limits       = DefaultLimits
+	mu           sync.Mutex
+	sessionBytes int64     // committed and reserved
+	usage        int64     // measured, plus committed deltas
+	pending      int64     // root usage reserved by charges not yet committed
+	usageAt      time.Time // zero when usage must be measured again
+)
+
+func init() {
+	for env, dst := range map[string]*int64{
+		"ENGL_MAX_WRITE_BYTES":   &limits.MaxWriteBytes,
+		"ENGL_MAX_SESSION_BYTES": &limits.MaxSessionBytes,
+		"ENGL_MAX_ROOT_BYTES":    &limits.MaxRootBytes,
+	} {
+		if v := os.Getenv(env); v != "" {
+			n, err := ParseSize(v)
+			if err != nil {
+				panic(env + ": " + err.Error())
+			}
+			*dst = n
+		}
+	}
+}
+
+// SetLimits replaces the limits and resets the session count (for testing)
+func SetLimits(l Limits) {
+	mu.Lock()
+	defer mu.Unlock()
+	limits = l
+	sessionBytes = 0
+	pending = 0
+	usageAt = time.Time{}
+}
+
+// ParseSize parses a byte count such as "1048576", "512K", "10MB" or "1G".
+// Units are powers of 1024.
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSuffix(s, u.suffix), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid size: " + s)
+	}
+	return n * mult, nil
+}
+
+// Change is one file a tool is about to write or delete. Size is the
+// file's full size after the write. Partial marks a change that keeps the
+// file's existing content, such as an append or an edit: only its growth
+// counts toward the per-write and session limits.
+type Change struct {
+	Path    string
+	Size    int64
+	Partial bool
+	Delete  bool
+}
+
+// Charge is the cost of an accepted set of changes. Check reserves it so
+// concurrent writers cannot together exceed a limit; Commit keeps it once
+// the changes are written and Release gives it back if they were not.
+type Charge struct {
+	bytes int64
+	delta int64
+	done  bool
+}
+
+// Check reports whether changes fit within the limits and reserves their
+// cost. All changes from a single tool call count as one write. Callers
+// should defer Release on the returned charge.
+func Check(changes ...Change) (*Charge, error) {
+	c := &Charge{}
+	final := map[string]Change{}
+	for _, ch := range changes {
+		switch {
+		case ch.Delete:
+		case ch.Partial:
+			c.bytes += max(0, ch.Size-existingSize(ch.Path))
+		default:
+			c.bytes += ch.Size
+		}
+		final[ch.Path] = ch
+	}
+	for path, ch := range final {
+		if !ch.Delete {
+			c.delta += ch.Size
+		}
+		c.delta -= existingSize(path)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if limits.MaxWriteBytes > 0 && c.bytes > limits.MaxWriteBytes {
+		return nil, fmt.Errorf("%w: writing %d bytes exceeds the per-write limit of %d bytes",
+			ErrQuotaExceeded, c.bytes, limits.MaxWriteBytes)
+	}
+	if limits.MaxSessionBytes > 0 && sessionBytes+c.bytes > limits.MaxSessionBytes {
+		return nil, fmt.Errorf("%w: writing %d bytes would bring this session to %d bytes, over the limit of %d bytes",
+			ErrQuotaExceeded, c.bytes, sessionBytes+c.bytes, limits.MaxSessionBytes)
+	}
+	if limits.MaxRootBytes > 0 && c.delta > 0 {
+		current, err := rootUsageLocked()
+		if err != nil {
+			return nil, err
+		}
+		if current+pending+c.delta > limits.MaxRootBytes {
+			return nil, fmt.Errorf("%w: writing %d bytes would bring disk usage under the root to %d bytes, over the limit of %d bytes",
+				ErrQuotaExceeded, c.bytes, current+pending+c.delta, limits.MaxRootBytes)
+		}
+	}
+
+	sessionBytes += c.bytes
+	pending += c.delta
+	return c, nil
+}
+
+// Commit records a charge after its changes were written
+func (c *Charge) Commit() {
+	if c == nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if c.done {
+		return
+	}
+	c.done = true
+	pending -= c.delta
+	usage += c.delta
+}
+
+// Release returns a reservation whose changes were not written. It does
+// nothing once the charge is committed, so it can always be deferred.
+func (c *Charge) Release() {
+	if c == nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if c.done {
+		return
+	}
+	c.done = true
+	sessionBytes -= c.bytes
+	pending -= c.delta
+}
+
+// Invalidate forces disk usage to be measured again, for changes that are
+// not charged such as deletes and moves
+func Invalidate() {
+	mu.Lock()
+	defer mu.Unlock()
+	usageAt = time.Time{}
+}
+
+func rootUsageLocked() (int64, error) {
+	if !usageAt.IsZero() && time.Since(usageAt) < usageTTL {
+		return usage, nil
+	}
+
+	var total int64
+	err := filepath.WalkDir(pathutil.GetAllowedRoot(), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // unreadable entries are not counted
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	usage, usageAt = total, time.Now()
+	return usage, nil
+}
+
+func existingSize(path string) int64 {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,178 @@
+package quota
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/phillip-england/engl/pkg/pathutil"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "1024", want: 1024},
+		{in: "512K", want: 512 << 10},
+		{in: "10mb", want: 10 << 20},
+		{in: "1 GB", want: 1 << 30},
+		{in: "7B", want: 7},
+		{in: "lots", wantErr: true},
+		{in: "-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSize(%q): got error %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tmpDir := t.TempDir()
+	old := pathutil.GetAllowedRoot()
+	pathutil.SetAllowedRoot(tmpDir)
+	defer pathutil.SetAllowedRoot(old)
+	defer SetLimits(DefaultLimits)
+
+	existing := filepath.Join(tmpDir, "existing.txt")
+	os.WriteFile(existing, make([]byte, 60), 0644)
+
+	t.Run("per write", func(t *testing.T) {
+		SetLimits(Limits{MaxWriteBytes: 100})
+		if _, err := Check(Change{Path: "a", Size: 100}); err != nil {
+			t.Errorf("write at the limit: %v", err)
+		}
+		_, err := Check(Change{Path: "a", Size: 60}, Change{Path: "b", Size: 60})
+		if !errors.Is(err, ErrQuotaExceeded) || !strings.Contains(err.Error(), "per-write limit of 100 bytes") {
+			t.Errorf("got %v, want per-write quota error", err)
+		}
+	})
+
+	t.Run("per session", func(t *testing.T) {
+		SetLimits(Limits{MaxSessionBytes: 100})
+		charge, err := Check(Change{Path: "a", Size: 70})
+		if err != nil {
+			t.Fatal(err)
+		}
+		charge.Commit()
+		if _, err := Check(Change{Path: "b", Size: 31}); !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("got %v, want session quota error", err)
+		}
+		if _, err := Check(Change{Path: "b", Size: 30}); err != nil {
+			t.Errorf("write within session limit: %v", err)
+		}
+	})
+
+	t.Run("root usage", func(t *testing.T) {
+		SetLimits(Limits{MaxRootBytes: 100})
+		if _, err := Check(Change{Path: filepath.Join(tmpDir, "new.txt"), Size: 41}); !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("got %v, want root quota error", err)
+		}
+
+		// Replacing a file only charges the growth
+		charge, err := Check(Change{Path: existing, Size: 100})
+		if err != nil {
+			t.Fatalf("replace within root limit: %v", err)
+		}
+		charge.Commit()
+		if _, err := Check(Change{Path: filepath.Join(tmpDir, "new.txt"), Size: 1}); !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("got %v after commit, want root quota error", err)
+		}
+
+		// Deletes free space
+		if _, err := Check(Change{Path: existing, Delete: true}, Change{Path: filepath.Join(tmpDir, "new.txt"), Size: 40}); err != nil {
+			t.Errorf("delete and write: %v", err)
+		}
+	})
+
+	t.Run("partial changes", func(t *testing.T) {
+		SetLimits(Limits{MaxWriteBytes: 10, MaxSessionBytes: 12})
+
+		// Only growth over the 60 bytes on disk is charged
+		charge, err := Check(Change{Path: existing, Size: 70, Partial: true})
+		if err != nil {
+			t.Fatalf("append within the per-write limit: %v", err)
+		}
+		charge.Commit()
+		if _, err := Check(Change{Path: existing, Size: 71, Partial: true}); !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("got %v, want per-write quota error", err)
+		}
+		if _, err := Check(Change{Path: existing, Size: 20, Partial: true}); err != nil {
+			t.Errorf("shrinking edit: %v", err)
+		}
+		if _, err := Check(Change{Path: existing, Size: 63, Partial: true}); !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("got %v, want session quota error", err)
+		}
+	})
+
+	t.Run("reservations", func(t *testing.T) {
+		SetLimits(Limits{MaxSessionBytes: 100, MaxRootBytes: 200})
+
+		// A check that has not committed yet still holds its bytes
+		first, err := Check(Change{Path: filepath.Join(tmpDir, "one.txt"), Size: 60})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Check(Change{Path: filepath.Join(tmpDir, "two.txt"), Size: 60}); !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("got %v while the first write is pending, want quota error", err)
+		}
+
+		// Releasing gives the bytes back; releasing twice does nothing
+		first.Release()
+		first.Release()
+		second, err := Check(Change{Path: filepath.Join(tmpDir, "two.txt"), Size: 60})
+		if err != nil {
+			t.Fatalf("after release: %v", err)
+		}
+		second.Commit()
+		second.Release()
+		if _, err := Check(Change{Path: filepath.Join(tmpDir, "three.txt"), Size: 41}); !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("got %v, want release after commit to keep the charge", err)
+		}
+	})
+
+	t.Run("concurrent writers", func(t *testing.T) {
+		SetLimits(Limits{MaxSessionBytes: 1000})
+		var wg sync.WaitGroup
+		var accepted atomic.Int64
+		for range 50 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if charge, err := Check(Change{Path: "f", Size: 100}); err == nil {
+					accepted.Add(1)
+					charge.Commit()
+				}
+			}()
+		}
+		wg.Wait()
+		if accepted.Load() != 10 {
+			t.Errorf("accepted %d writes of 100 bytes under a 1000 byte limit", accepted.Load())
+		}
+	})
+
+	t.Run("state directory counts", func(t *testing.T) {
+		// Deleted files kept in the trash still take up space under the root
+		trashed := filepath.Join(pathutil.StateDir(), "trash", "blob")
+		os.MkdirAll(filepath.Dir(trashed), 0755)
+		os.WriteFile(trashed, make([]byte, 1000), 0644)
+		defer os.RemoveAll(pathutil.StateDir())
+
+		SetLimits(Limits{MaxRootBytes: 1000})
+		if _, err := Check(Change{Path: filepath.Join(tmpDir, "new.txt"), Size: 1}); !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("got %v, want root quota error", err)
+		}
+	})
+}
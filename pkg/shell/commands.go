@@ -1,41 +1,148 @@
 package shell
 
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTimeout bounds a command that sets no timeout of its own
+	DefaultTimeout = 30 * time.Second
+	// MaxTimeout is the longest timeout a config entry may set
+	MaxTimeout = time.Hour
+)
+
+// Command is one entry in the allowlist. Path pins the binary to run;
+// when empty Name is looked up on PATH. BaseArgs are placed before the
+// caller's arguments, so an entry can expose a single subcommand such as
+// "go vet". Args restricts the arguments callers may pass. Timeout, a
+// duration such as "2m", is the longest a call may run; requests can only
+// shorten it. MaxOutput, a size such as "64KB", caps each output stream.
+// Env names server variables passed through beyond the base set; requests
+// may override only these.
 type Command struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Example     string `json:"example"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Example     string     `json:"example"`
+	Path        string     `json:"path,omitempty"`
+	BaseArgs    []string   `json:"base_args,omitempty"`
+	Args        *ArgPolicy `json:"args,omitempty"`
+	Timeout     string     `json:"timeout,omitempty"`
+	MaxOutput   string     `json:"max_output,omitempty"`
+	Env         []string   `json:"env,omitempty"`
+
+	timeout   time.Duration // parsed from Timeout by Validate
+	maxOutput int           // parsed from MaxOutput by Validate
 }
 
-// AllowedCommands - Add new commands here
-var AllowedCommands = []Command{
+// DefaultCommands are allowed when no config file is given
+var DefaultCommands = []Command{
 	{
 		Name:        "tree",
 		Description: "Display directory tree structure",
 		Example:     "tree /path -L 2",
+		Args: &ArgPolicy{
+			StrictFlags:     true,
+			AllowedFlags:    []string{"-a", "-d", "-f", "-i", "-l", "-x", "-p", "-s", "-h", "-D", "-F", "-C", "-n", "-r", "-t", "--noreport", "--dirsfirst"},
+			DeniedFlags:     []string{"-o"},
+			ValueFlags:      []string{"-L", "-P", "-I"},
+			ValuePatterns:   map[string]string{"-L": "[0-9]+"},
+			PositionalPaths: true,
+		},
 	},
 	{
 		Name:        "cat",
 		Description: "Display file contents",
 		Example:     "cat file.txt",
+		Args: &ArgPolicy{
+			StrictFlags:     true,
+			AllowedFlags:    []string{"-n", "-b", "-s", "-A", "-E", "-T", "-v"},
+			PositionalPaths: true,
+			MinPositional:   1,
+		},
 	},
 	{
 		Name:        "ls",
 		Description: "List directory contents",
 		Example:     "ls -la /path",
+		Args: &ArgPolicy{
+			StrictFlags:     true,
+			AllowedFlags:    []string{"-l", "-a", "-A", "-h", "-R", "-t", "-S", "-r", "-1", "-d", "-F", "-i", "-s"},
+			PositionalPaths: true,
+		},
 	},
 	{
 		Name:        "pwd",
 		Description: "Print working directory",
 		Example:     "pwd",
+		Args: &ArgPolicy{
+			StrictFlags:   true,
+			AllowedFlags:  []string{"-L", "-P"},
+			MaxPositional: intPtr(0),
+		},
 	},
 }
 
-// commandAllowed checks if a command is in the allowed list
-func commandAllowed(name string) bool {
-	for _, cmd := range AllowedCommands {
+func init() {
+	if err := (Config{Commands: DefaultCommands}).Validate(); err != nil {
+		panic("default shell commands: " + err.Error())
+	}
+}
+
+var (
+	commandsMu sync.RWMutex
+	commands   = DefaultCommands
+)
+
+// Commands returns the current allowlist
+func Commands() []Command {
+	commandsMu.RLock()
+	defer commandsMu.RUnlock()
+	return commands
+}
+
+// setCommands replaces the allowlist
+func setCommands(cmds []Command) {
+	commandsMu.Lock()
+	defer commandsMu.Unlock()
+	commands = cmds
+}
+
+// lookupCommand finds an allowed command by name
+func lookupCommand(name string) (Command, bool) {
+	for _, cmd := range Commands() {
 		if cmd.Name == name {
-			return true
+			return cmd, true
 		}
 	}
-	return false
+	return Command{}, false
+}
+
+// binary returns the program to run for cmd
+func (c Command) binary() string {
+	if c.Path != "" {
+		return c.Path
+	}
+	return c.Name
+}
+
+// timeoutFor returns how long a call may run given the timeout a request
+// asked for, if any
+func (c Command) timeoutFor(requested time.Duration) time.Duration {
+	limit := DefaultTimeout
+	if c.timeout > 0 {
+		limit = c.timeout
+	}
+	if requested > 0 {
+		return min(requested, limit)
+	}
+	return limit
+}
+
+// outputLimit returns how many bytes of each output stream a call returns
+func (c Command) outputLimit() int {
+	if c.maxOutput > 0 {
+		return c.maxOutput
+	}
+	return DefaultMaxOutput
 }
@@ -0,0 +1,155 @@
+package shell
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/phillip-england/engl/pkg/pathutil"
+	"github.com/phillip-england/engl/pkg/quota"
+)
+
+// Config is the shell allowlist file, for example:
+//
+//	{
+//	  "commands": [
+//	    {"name": "grep", "description": "Search files", "example": "grep -rn TODO ."},
+//	    {"name": "govet", "path": "/usr/local/go/bin/go", "base_args": ["vet"],
+//	     "timeout": "2m", "max_output": "64KB", "env": ["HOME", "GOFLAGS"]}
+//	  ]
+//	}
+type Config struct {
+	Commands []Command `json:"commands"`
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+var errConfigInRoot = errors.New("shell config must be outside the allowed root, where the file tools cannot edit it")
+
+var (
+	configMu   sync.Mutex
+	configPath string
+)
+
+// LoadConfig loads and validates the allowlist from path and remembers path
+// for Reload. An empty path restores DefaultCommands. The file must sit
+// outside the allowed root, or callers could widen the allowlist with the
+// write tool and a reload. On error the current allowlist is kept.
+func LoadConfig(path string) error {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	cmds := DefaultCommands
+	if path != "" {
+		cfg, err := readConfig(path)
+		if err != nil {
+			return err
+		}
+		cmds = cfg.Commands
+	}
+
+	configPath = path
+	setCommands(cmds)
+	return nil
+}
+
+// Reload reads the config file given to LoadConfig again
+func Reload() error {
+	configMu.Lock()
+	path := configPath
+	configMu.Unlock()
+	return LoadConfig(path)
+}
+
+func readConfig(path string) (Config, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("shell config: %w", err)
+	}
+	if _, err := pathutil.ValidatePath(abs); err == nil || pathutil.OverlapsStateDir(abs) {
+		return Config{}, fmt.Errorf("shell config %s: %w", path, errConfigInRoot)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("shell config: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("shell config %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("shell config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks that every command has a unique, plain name and well
+// formed settings, and that any pinned binary is an absolute path to an
+// executable file
+func (c Config) Validate() error {
+	if len(c.Commands) == 0 {
+		return errors.New("no commands defined")
+	}
+
+	seen := map[string]bool{}
+	for i, cmd := range c.Commands {
+		if !validName.MatchString(cmd.Name) {
+			return fmt.Errorf("command %d: invalid name %q", i+1, cmd.Name)
+		}
+		if seen[cmd.Name] {
+			return fmt.Errorf("command %q: defined more than once", cmd.Name)
+		}
+		seen[cmd.Name] = true
+
+		if cmd.Args != nil {
+			if err := cmd.Args.compile(); err != nil {
+				return fmt.Errorf("command %q: %w", cmd.Name, err)
+			}
+		}
+
+		if cmd.Timeout != "" {
+			d, err := time.ParseDuration(cmd.Timeout)
+			if err != nil || d <= 0 || d > MaxTimeout {
+				return fmt.Errorf("command %q: invalid timeout %q; want a duration up to %s", cmd.Name, cmd.Timeout, MaxTimeout)
+			}
+			c.Commands[i].timeout = d
+		}
+
+		if cmd.MaxOutput != "" {
+			n, err := quota.ParseSize(cmd.MaxOutput)
+			if err != nil || n <= 0 || n > MaxOutput {
+				return fmt.Errorf("command %q: invalid max_output %q; want a size up to %dMB", cmd.Name, cmd.MaxOutput, MaxOutput>>20)
+			}
+			c.Commands[i].maxOutput = int(n)
+		}
+
+		for _, name := range cmd.Env {
+			if err := checkEnvName(name); err != nil {
+				return fmt.Errorf("command %q: %w", cmd.Name, err)
+			}
+		}
+
+		if cmd.Path == "" {
+			continue
+		}
+		if !filepath.IsAbs(cmd.Path) {
+			return fmt.Errorf("command %q: path must be absolute: %s", cmd.Name, cmd.Path)
+		}
+		info, err := os.Stat(cmd.Path)
+		if err != nil {
+			return fmt.Errorf("command %q: %w", cmd.Name, err)
+		}
+		if info.IsDir() || (runtime.GOOS != "windows" && info.Mode().Perm()&0111 == 0) {
+			return fmt.Errorf("command %q: %s is not an executable file", cmd.Name, cmd.Path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package shell
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phillip-england/engl/pkg/pathutil"
+)
+
+func writeConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, "commands.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigValidate(t *testing.T) {
+	tmpDir := t.TempDir()
+	script := filepath.Join(tmpDir, "tool")
+	os.WriteFile(script, []byte("#!/bin/sh\n"), 0755)
+	plain := filepath.Join(tmpDir, "plain")
+	os.WriteFile(plain, nil, 0644)
+
+	tests := []struct {
+		name    string
+		cmds    []Command
+		wantErr string
+	}{
+		{name: "valid", cmds: []Command{{Name: "grep"}, {Name: "tool", Path: script, BaseArgs: []string{"run"}}}},
+		{name: "empty", cmds: nil, wantErr: "no commands defined"},
+		{name: "bad name", cmds: []Command{{Name: "rm -rf"}}, wantErr: `invalid name "rm -rf"`},
+		{name: "duplicate", cmds: []Command{{Name: "ls"}, {Name: "ls"}}, wantErr: "defined more than once"},
+		{name: "relative path", cmds: []Command{{Name: "x", Path: "bin/x"}}, wantErr: "path must be absolute"},
+		{name: "missing binary", cmds: []Command{{Name: "x", Path: filepath.Join(tmpDir, "nope")}}, wantErr: "no such file"},
+		{name: "not executable", cmds: []Command{{Name: "x", Path: plain}}, wantErr: "is not an executable file"},
+		{name: "timeout", cmds: []Command{{Name: "make", Timeout: "5m"}}},
+		{name: "bad timeout", cmds: []Command{{Name: "make", Timeout: "soon"}}, wantErr: `invalid timeout "soon"`},
+		{name: "max output", cmds: []Command{{Name: "make", MaxOutput: "64KB"}}},
+		{name: "bad max output", cmds: []Command{{Name: "make", MaxOutput: "lots"}}, wantErr: `invalid max_output "lots"`},
+		{name: "env allowlist", cmds: []Command{{Name: "go", Env: []string{"HOME", "GOFLAGS"}}}},
+		{name: "loader env", cmds: []Command{{Name: "go", Env: []string{"LD_PRELOAD"}}}, wantErr: "env LD_PRELOAD is not allowed"},
+		{name: "timeout too long", cmds: []Command{{Name: "make", Timeout: "48h"}}, wantErr: "want a duration up to 1h0m0s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Config{Commands: tt.cmds}.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadAndReload(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer LoadConfig("")
+
+	path := writeConfig(t, tmpDir, `{"commands": [{"name": "grep", "description": "Search files"}]}`)
+	if err := LoadConfig(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := lookupCommand("grep"); !ok {
+		t.Error("grep should be allowed after load")
+	}
+	if _, ok := lookupCommand("ls"); ok {
+		t.Error("ls should not be allowed once a config replaces the defaults")
+	}
+
+	// A broken file is rejected and the previous allowlist stays
+	writeConfig(t, tmpDir, `{"commands": [{"name": ""}]}`)
+	rec := httptest.NewRecorder()
+	ReloadHandler(rec, httptest.NewRequest(http.MethodPost, "/mcp/tool/shell/reload", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want 400", rec.Code)
+	}
+	if _, ok := lookupCommand("grep"); !ok {
+		t.Error("grep should still be allowed after a failed reload")
+	}
+
+	// A config the file tools could edit is refused
+	old := pathutil.GetAllowedRoot()
+	pathutil.SetAllowedRoot(tmpDir)
+	writeConfig(t, tmpDir, `{"commands": [{"name": "sh"}]}`)
+	if err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), errConfigInRoot.Error()) {
+		t.Errorf("got error %v for a config inside the root", err)
+	}
+	if err := Reload(); err == nil {
+		t.Error("reload accepted a config inside the root")
+	}
+	pathutil.SetAllowedRoot(old)
+	if _, ok := lookupCommand("sh"); ok {
+		t.Error("sh should not be allowed")
+	}
+
+	writeConfig(t, tmpDir, `{"commands": [{"name": "wc"}, {"name": "head"}]}`)
+	rec = httptest.NewRecorder()
+	ReloadHandler(rec, httptest.NewRequest(http.MethodPost, "/mcp/tool/shell/reload", nil))
+	var resp ReloadResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || len(resp.Commands) != 2 {
+		t.Errorf("got status %d, resp %+v", rec.Code, resp)
+	}
+
+	rec = httptest.NewRecorder()
+	ListHandler(rec, httptest.NewRequest(http.MethodGet, "/mcp/tool/shell/list", nil))
+	var list ListResponse
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list.Commands) != 2 || list.Commands[0].Name != "wc" {
+		t.Errorf("list does not reflect reloaded config: %+v", list.Commands)
+	}
+}
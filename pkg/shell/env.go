@@ -0,0 +1,59 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// baseEnv are the variables every command gets from the server's
+// environment, when set. Commands see nothing else unless their config
+// entry lists it in Env.
+var baseEnv = []string{"PATH", "LANG", "LC_ALL", "TZ", "TMPDIR", "SYSTEMROOT", "COMSPEC", "PATHEXT", "TEMP", "TMP"}
+
+var validEnvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// checkEnvName rejects malformed names and variables that make the dynamic
+// loader run code, which no allowlist may pass through
+func checkEnvName(name string) error {
+	if !validEnvName.MatchString(name) {
+		return fmt.Errorf("invalid env name %q", name)
+	}
+	upper := strings.ToUpper(name)
+	if strings.HasPrefix(upper, "LD_") || strings.HasPrefix(upper, "DYLD_") {
+		return fmt.Errorf("env %s is not allowed", name)
+	}
+	return nil
+}
+
+// environ builds a command's environment: the base variables and the
+// command's allowlist taken from the server, then the request's overrides.
+// Only variables on the command's allowlist may be overridden.
+func (c Command) environ(overrides map[string]string) ([]string, error) {
+	vars := map[string]string{}
+	for _, name := range slices.Concat(baseEnv, c.Env) {
+		if v, ok := os.LookupEnv(name); ok {
+			vars[name] = v
+		}
+	}
+
+	for name, v := range overrides {
+		if !slices.Contains(c.Env, name) {
+			return nil, fmt.Errorf("env %s may not be set for %s", name, c.Name)
+		}
+		if strings.ContainsRune(v, 0) {
+			return nil, fmt.Errorf("env %s contains a NUL byte", name)
+		}
+		vars[name] = v
+	}
+
+	env := make([]string, 0, len(vars))
+	for name, v := range vars {
+		env = append(env, name+"="+v)
+	}
+	sort.Strings(env)
+	return env, nil
+}
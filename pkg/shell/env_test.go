@@ -0,0 +1,69 @@
+package shell
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEnviron(t *testing.T) {
+	t.Setenv("PATH", "/usr/bin")
+	t.Setenv("HOME", "/home/engl")
+	t.Setenv("SECRET_TOKEN", "hunter2")
+	t.Setenv("GOFLAGS", "-mod=mod")
+
+	cmd := Command{Name: "go", Env: []string{"HOME", "GOFLAGS", "GOOS"}}
+
+	tests := []struct {
+		name      string
+		overrides map[string]string
+		want      []string
+		wantErr   string
+	}{
+		{name: "base and allowlist", want: []string{"GOFLAGS=-mod=mod", "HOME=/home/engl", "PATH=/usr/bin"}},
+		{name: "override", overrides: map[string]string{"GOFLAGS": "-v", "GOOS": "windows"}, want: []string{"GOFLAGS=-v", "GOOS=windows", "HOME=/home/engl", "PATH=/usr/bin"}},
+		{name: "base var not overridable", overrides: map[string]string{"PATH": "/tmp"}, wantErr: "env PATH may not be set for go"},
+		{name: "unlisted var", overrides: map[string]string{"LD_PRELOAD": "x.so"}, wantErr: "env LD_PRELOAD may not be set for go"},
+		{name: "nul byte", overrides: map[string]string{"GOOS": "a\x00b"}, wantErr: "contains a NUL byte"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cmd.environ(tt.overrides)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Other base variables may be set in the test environment
+			got = slices.DeleteFunc(got, func(kv string) bool {
+				name, _, _ := strings.Cut(kv, "=")
+				return !slices.Contains(cmd.Env, name) && name != "PATH"
+			})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckEnvName(t *testing.T) {
+	for name, wantErr := range map[string]string{
+		"HOME":            "",
+		"_private":        "",
+		"1BAD":            `invalid env name "1BAD"`,
+		"A=B":             `invalid env name "A=B"`,
+		"LD_PRELOAD":      "env LD_PRELOAD is not allowed",
+		"ld_library_path": "env ld_library_path is not allowed",
+		"DYLD_INSERT":     "env DYLD_INSERT is not allowed",
+	} {
+		err := checkEnvName(name)
+		if (err == nil) != (wantErr == "") || (err != nil && err.Error() != wantErr) {
+			t.Errorf("%s: got error %v, want %q", name, err, wantErr)
+		}
+	}
+}
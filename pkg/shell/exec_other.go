@@ -0,0 +1,15 @@
+//go:build !unix
+
+package shell
+
+import (
+	"os"
+	"os/exec"
+)
+
+// killProcessGroup leaves the default cancel, which kills only the process
+// itself, where process groups are not available
+func killProcessGroup(cmd *exec.Cmd) {}
+
+// exitSignal is always empty where processes are not ended by signals
+func exitSignal(state *os.ProcessState) string { return "" }
@@ -1,28 +1,60 @@
 package shell
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"os"
 	"os/exec"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/phillip-england/engl/pkg/pathutil"
 )
 
+// ExecRequest runs Command with Args. Dir is the working directory, the
+// allowed root by default; relative paths in Args are resolved against it.
+// Env overrides variables on the command's env allowlist and Stdin is fed
+// to the process. SaveOutput, if set, is a new file inside the root that
+// receives the full, untruncated output.
 type ExecRequest struct {
-	Command string   `json:"command"`
-	Args    []string `json:"args"`
+	Command    string            `json:"command"`
+	Args       []string          `json:"args"`
+	Dir        string            `json:"dir,omitempty"`
+	Env        map[string]string `json:"env,omitempty"`
+	Stdin      string            `json:"stdin,omitempty"`
+	Timeout    string            `json:"timeout,omitempty"`
+	SaveOutput string            `json:"save_output,omitempty"`
 }
 
+// ExecResponse is the result of a command that ran. Output over the
+// command's limit keeps its head and tail with a marker between them. Error
+// is set only when the command could not be started, did not finish on its
+// own or its output could not be saved; a non-zero exit is reported through
+// ExitCode.
 type ExecResponse struct {
-	Output string `json:"output,omitempty"`
-	Error  string `json:"error,omitempty"`
+	Stdout     string `json:"stdout,omitempty"`
+	Stderr     string `json:"stderr,omitempty"`
+	Truncated  bool   `json:"truncated,omitempty"`
+	OutputFile string `json:"output_file,omitempty"`
+	*ExitStatus
+	Error string `json:"error,omitempty"`
 }
 
 type ListResponse struct {
 	Commands []Command `json:"commands"`
 }
 
+type ReloadResponse struct {
+	Success  bool      `json:"success"`
+	Commands []Command `json:"commands,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
 // ListHandler returns all available commands
 func ListHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet && r.Method != http.MethodPost {
@@ -33,7 +65,28 @@ func ListHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("HIT: %s", r.URL.Path)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(ListResponse{Commands: AllowedCommands})
+	json.NewEncoder(w).Encode(ListResponse{Commands: Commands()})
+}
+
+// ReloadHandler re-reads the shell config file. If the file is invalid the
+// current allowlist stays in effect and the error is returned.
+func ReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	log.Printf("HIT: %s", r.URL.Path)
+
+	if err := Reload(); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ReloadResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ReloadResponse{Success: true, Commands: Commands()})
 }
 
 // ExecHandler executes an allowed shell command
@@ -50,47 +103,138 @@ func ExecHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	if req.Command == "" {
-		writeExecError(w, "command is required")
+	plan, err := prepare(req)
+	if err != nil {
+		writeExecError(w, err.Error())
 		return
 	}
 
-	if !commandAllowed(req.Command) {
-		writeExecError(w, "command not allowed: "+req.Command)
+	log.Printf("HIT: %s | Command: %s %v | Dir: %s | Timeout: %s", r.URL.Path, req.Command, plan.args, plan.dir, plan.timeout)
+
+	// The command is cancelled when it runs too long or the client goes away
+	ctx, cancel := context.WithTimeout(r.Context(), plan.timeout)
+	defer cancel()
+
+	var saved *outputFile
+	if req.SaveOutput != "" {
+		if saved, err = createOutputFile(req.SaveOutput); err != nil {
+			writeExecError(w, err.Error())
+			return
+		}
+	}
+
+	stdout := &headTailBuffer{limit: plan.command.outputLimit()}
+	stderr := &headTailBuffer{limit: plan.command.outputLimit()}
+	cmd := plan.cmd(ctx)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if saved != nil {
+		cmd.Stdout, cmd.Stderr = io.MultiWriter(stdout, saved), io.MultiWriter(stderr, saved)
+	}
+
+	start := time.Now()
+	err = cmd.Run()
+	elapsed := time.Since(start)
+
+	var outputFile string
+	var saveErr error
+	if saved != nil {
+		outputFile, saveErr = saved.finish()
+	}
+
+	if r.Context().Err() != nil {
+		log.Printf("Client disconnected, killed: %s", req.Command)
 		return
 	}
 
-	// Validate path arguments
-	validatedArgs := make([]string, len(req.Args))
-	for i, arg := range req.Args {
-		if pathutil.IsPathArg(arg) {
-			validPath, err := pathutil.ValidatePath(arg)
-			if err != nil {
-				writeExecError(w, "access denied for argument '"+arg+"': "+err.Error())
-				return
-			}
-			validatedArgs[i] = validPath
-		} else {
-			validatedArgs[i] = arg
+	status, err := exitStatus(ctx, cmd, err, plan.timeout, elapsed)
+	resp := ExecResponse{
+		Stdout:     stdout.String(),
+		Stderr:     stderr.String(),
+		Truncated:  stdout.truncated() || stderr.truncated(),
+		OutputFile: outputFile,
+		ExitStatus: &status,
+	}
+	if err = errors.Join(err, saveErr); err != nil {
+		resp.Error = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// execPlan is an exec request checked against the allowlist
+type execPlan struct {
+	command Command
+	args    []string
+	dir     string
+	env     []string
+	stdin   string
+	timeout time.Duration
+}
+
+// prepare checks an exec request against the allowlist and works out how
+// to run it
+func prepare(req ExecRequest) (execPlan, error) {
+	if req.Command == "" {
+		return execPlan{}, errors.New("command is required")
+	}
+
+	command, ok := lookupCommand(req.Command)
+	if !ok {
+		return execPlan{}, errors.New("command not allowed: " + req.Command)
+	}
+
+	dir := pathutil.GetAllowedRoot()
+	if req.Dir != "" {
+		validDir, err := pathutil.ValidatePath(req.Dir)
+		if err != nil {
+			return execPlan{}, errors.New("access denied: " + err.Error())
 		}
+		if info, err := os.Stat(validDir); err != nil || !info.IsDir() {
+			return execPlan{}, errors.New("dir is not a directory: " + req.Dir)
+		}
+		dir = validDir
 	}
 
-	log.Printf("HIT: %s | Command: %s %v", r.URL.Path, req.Command, validatedArgs)
+	args, err := command.checkArgs(req.Args, dir)
+	if err != nil {
+		return execPlan{}, err
+	}
 
-	cmd := exec.Command(req.Command, validatedArgs...)
-	cmd.Dir = pathutil.GetAllowedRoot()
-	output, err := cmd.CombinedOutput()
+	env, err := command.environ(req.Env)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(ExecResponse{
-			Output: string(output),
-			Error:  err.Error(),
-		})
-		return
+		return execPlan{}, err
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(ExecResponse{Output: string(output)})
+	var requested time.Duration
+	if req.Timeout != "" {
+		requested, err = time.ParseDuration(req.Timeout)
+		if err != nil || requested <= 0 {
+			return execPlan{}, errors.New("invalid timeout: " + req.Timeout)
+		}
+	}
+
+	return execPlan{
+		command: command,
+		args:    args,
+		dir:     dir,
+		env:     env,
+		stdin:   req.Stdin,
+		timeout: command.timeoutFor(requested),
+	}, nil
+}
+
+// cmd builds the process to run, killed along with its children when ctx
+// is done
+func (p execPlan) cmd(ctx context.Context) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, p.command.binary(), slices.Concat(p.command.BaseArgs, p.args)...)
+	cmd.Dir = p.dir
+	cmd.Env = p.env
+	cmd.Stdin = strings.NewReader(p.stdin)
+	killProcessGroup(cmd)
+	// Don't wait forever on output pipes held open by a stray child
+	cmd.WaitDelay = time.Second
+	return cmd
 }
 
 func writeExecError(w http.ResponseWriter, msg string) {
@@ -0,0 +1,207 @@
+package shell
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phillip-england/engl/pkg/pathutil"
+)
+
+func withCommands(t *testing.T, cmds ...Command) func() {
+	t.Helper()
+	if err := (Config{Commands: cmds}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+	old := Commands()
+	setCommands(cmds)
+	return func() { setCommands(old) }
+}
+
+func TestExecTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh and sleep")
+	}
+	old := pathutil.GetAllowedRoot()
+	pathutil.SetAllowedRoot(t.TempDir())
+	defer pathutil.SetAllowedRoot(old)
+	defer withCommands(t,
+		Command{Name: "sh", Timeout: "200ms", Args: &ArgPolicy{}},
+		Command{Name: "echo", Args: &ArgPolicy{}},
+	)()
+
+	tests := []struct {
+		name         string
+		body         ExecRequest
+		wantTimedOut bool
+		wantErr      string
+		wantOutput   string
+	}{
+		{name: "finishes in time", body: ExecRequest{Command: "echo", Args: []string{"hi"}}, wantOutput: "hi\n"},
+		{name: "command timeout", body: ExecRequest{Command: "sh", Args: []string{"-c", "echo started; sleep 10"}}, wantTimedOut: true, wantErr: "command timed out after 200ms", wantOutput: "started\n"},
+		{name: "request shortens timeout", body: ExecRequest{Command: "sh", Args: []string{"-c", "sleep 10"}, Timeout: "50ms"}, wantTimedOut: true, wantErr: "command timed out after 50ms"},
+		{name: "request cannot extend timeout", body: ExecRequest{Command: "sh", Args: []string{"-c", "sleep 10"}, Timeout: "1m"}, wantTimedOut: true, wantErr: "command timed out after 200ms"},
+		// The background sleep keeps the output pipe open; it only closes
+		// promptly if the whole process group is killed
+		{name: "kills process group", body: ExecRequest{Command: "sh", Args: []string{"-c", "sleep 10 & sleep 10"}}, wantTimedOut: true, wantErr: "command timed out"},
+		{name: "bad timeout", body: ExecRequest{Command: "echo", Timeout: "soon"}, wantErr: "invalid timeout: soon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.body)
+			rec := httptest.NewRecorder()
+			start := time.Now()
+			ExecHandler(rec, httptest.NewRequest(http.MethodPost, "/mcp/tool/shell/exec", bytes.NewReader(body)))
+			if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+				t.Errorf("took %s", elapsed)
+			}
+
+			var resp ExecResponse
+			json.NewDecoder(rec.Body).Decode(&resp)
+			timedOut := resp.ExitStatus != nil && resp.TimedOut
+			if timedOut != tt.wantTimedOut {
+				t.Errorf("got timed_out %v, want %v", timedOut, tt.wantTimedOut)
+			}
+			if !strings.HasPrefix(resp.Error, tt.wantErr) || (tt.wantErr == "" && resp.Error != "") {
+				t.Errorf("got error %q, want %q", resp.Error, tt.wantErr)
+			}
+			if resp.Stdout != tt.wantOutput {
+				t.Errorf("got stdout %q, want %q", resp.Stdout, tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestExecResult(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	old := pathutil.GetAllowedRoot()
+	pathutil.SetAllowedRoot(t.TempDir())
+	defer pathutil.SetAllowedRoot(old)
+	defer withCommands(t,
+		Command{Name: "sh", Timeout: "200ms", Args: &ArgPolicy{}},
+		Command{Name: "seq", MaxOutput: "8", Args: &ArgPolicy{}},
+	)()
+
+	tests := []struct {
+		name       string
+		body       ExecRequest
+		wantStdout string
+		wantStderr string
+		wantStatus ExitStatus
+		wantErr    string
+		wantTrunc  bool
+		wantFile   string
+	}{
+		{name: "success", body: ExecRequest{Command: "sh", Args: []string{"-c", "echo out"}}, wantStdout: "out\n", wantStatus: ExitStatus{ExitCode: 0}},
+		{name: "separate streams", body: ExecRequest{Command: "sh", Args: []string{"-c", "echo out; echo err >&2"}}, wantStdout: "out\n", wantStderr: "err\n"},
+		{name: "non-zero exit is not an error", body: ExecRequest{Command: "sh", Args: []string{"-c", "echo nope >&2; exit 2"}}, wantStderr: "nope\n", wantStatus: ExitStatus{ExitCode: 2}},
+		{name: "killed by signal", body: ExecRequest{Command: "sh", Args: []string{"-c", "kill -TERM $$"}}, wantStatus: ExitStatus{ExitCode: -1, Signal: "terminated"}},
+		{name: "timed out", body: ExecRequest{Command: "sh", Args: []string{"-c", "sleep 10"}}, wantStatus: ExitStatus{ExitCode: -1, Signal: "killed", TimedOut: true}, wantErr: "command timed out after 200ms"},
+		{name: "truncated", body: ExecRequest{Command: "seq", Args: []string{"10"}}, wantStdout: "1\n2\n\n[... 13 bytes elided ...]\n\n10\n", wantTrunc: true},
+		{name: "save full output", body: ExecRequest{Command: "seq", Args: []string{"10"}, SaveOutput: "out/seq.txt"}, wantStdout: "1\n2\n\n[... 13 bytes elided ...]\n\n10\n", wantTrunc: true, wantFile: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.body)
+			rec := httptest.NewRecorder()
+			ExecHandler(rec, httptest.NewRequest(http.MethodPost, "/mcp/tool/shell/exec", bytes.NewReader(body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d", rec.Code)
+			}
+
+			var resp ExecResponse
+			json.NewDecoder(rec.Body).Decode(&resp)
+			if resp.ExitStatus == nil {
+				t.Fatal("missing exit status")
+			}
+			resp.DurationMs = 0
+			if *resp.ExitStatus != tt.wantStatus {
+				t.Errorf("got status %+v, want %+v", *resp.ExitStatus, tt.wantStatus)
+			}
+			if resp.Stdout != tt.wantStdout || resp.Stderr != tt.wantStderr {
+				t.Errorf("got stdout %q stderr %q", resp.Stdout, resp.Stderr)
+			}
+			if resp.Error != tt.wantErr || resp.Truncated != tt.wantTrunc {
+				t.Errorf("got error %q truncated %v", resp.Error, resp.Truncated)
+			}
+			if tt.wantFile != "" {
+				data, err := os.ReadFile(resp.OutputFile)
+				if err != nil || string(data) != tt.wantFile {
+					t.Errorf("got saved output %q, %v", data, err)
+				}
+			}
+		})
+	}
+}
+
+func TestExecContext(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	tmpDir := t.TempDir()
+	old := pathutil.GetAllowedRoot()
+	pathutil.SetAllowedRoot(tmpDir)
+	defer pathutil.SetAllowedRoot(old)
+	defer withCommands(t,
+		Command{Name: "sh", Env: []string{"GREETING"}, Args: &ArgPolicy{}},
+		Command{Name: "cat", Args: &ArgPolicy{PositionalPaths: true}},
+	)()
+
+	sub := filepath.Join(tmpDir, "sub")
+	os.Mkdir(sub, 0755)
+	os.WriteFile(filepath.Join(sub, "f.txt"), []byte("in sub"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "f.txt"), []byte("at root"), 0644)
+	t.Setenv("GREETING", "hello")
+	t.Setenv("SECRET_TOKEN", "hunter2")
+
+	tests := []struct {
+		name       string
+		body       ExecRequest
+		wantStatus int
+		wantStdout string
+		wantErr    string
+	}{
+		{name: "stdin", body: ExecRequest{Command: "cat", Stdin: "from stdin"}, wantStatus: http.StatusOK, wantStdout: "from stdin"},
+		{name: "no stdin", body: ExecRequest{Command: "cat"}, wantStatus: http.StatusOK},
+		{name: "default dir", body: ExecRequest{Command: "sh", Args: []string{"-c", "pwd"}}, wantStatus: http.StatusOK, wantStdout: tmpDir + "\n"},
+		{name: "dir", body: ExecRequest{Command: "sh", Args: []string{"-c", "pwd"}, Dir: "sub"}, wantStatus: http.StatusOK, wantStdout: sub + "\n"},
+		{name: "args relative to dir", body: ExecRequest{Command: "cat", Args: []string{"f.txt"}, Dir: "sub"}, wantStatus: http.StatusOK, wantStdout: "in sub"},
+		{name: "dir outside root", body: ExecRequest{Command: "cat", Dir: "/etc"}, wantStatus: http.StatusBadRequest, wantErr: "access denied"},
+		{name: "dir is a file", body: ExecRequest{Command: "cat", Dir: "f.txt"}, wantStatus: http.StatusBadRequest, wantErr: "dir is not a directory: f.txt"},
+		{name: "allowed env", body: ExecRequest{Command: "sh", Args: []string{"-c", "echo $GREETING"}}, wantStatus: http.StatusOK, wantStdout: "hello\n"},
+		{name: "env override", body: ExecRequest{Command: "sh", Args: []string{"-c", "echo $GREETING"}, Env: map[string]string{"GREETING": "hi"}}, wantStatus: http.StatusOK, wantStdout: "hi\n"},
+		{name: "server env not leaked", body: ExecRequest{Command: "sh", Args: []string{"-c", "echo \"[$SECRET_TOKEN]\""}}, wantStatus: http.StatusOK, wantStdout: "[]\n"},
+		{name: "env not on allowlist", body: ExecRequest{Command: "sh", Args: []string{"-c", "true"}, Env: map[string]string{"SECRET_TOKEN": "x"}}, wantStatus: http.StatusBadRequest, wantErr: "env SECRET_TOKEN may not be set for sh"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.body)
+			rec := httptest.NewRecorder()
+			ExecHandler(rec, httptest.NewRequest(http.MethodPost, "/mcp/tool/shell/exec", bytes.NewReader(body)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			var resp ExecResponse
+			json.NewDecoder(rec.Body).Decode(&resp)
+			if !strings.HasPrefix(resp.Error, tt.wantErr) || (tt.wantErr == "" && resp.Error != "") {
+				t.Errorf("got error %q, want %q", resp.Error, tt.wantErr)
+			}
+			if resp.Stdout != tt.wantStdout {
+				t.Errorf("got stdout %q, want %q", resp.Stdout, tt.wantStdout)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/phillip-england/engl/pkg/pathutil"
+	"github.com/phillip-england/engl/pkg/quota"
+)
+
+const (
+	// DefaultMaxOutput is how much of each output stream a command returns
+	// when it sets no max_output of its own
+	DefaultMaxOutput = 1 << 20
+	// MaxOutput is the largest max_output a config entry may set
+	MaxOutput = 64 << 20
+)
+
+// ExitStatus describes how a command finished. A non-zero exit code is a
+// normal result, not an error; ExitCode is -1 when the process was killed
+// or never started.
+type ExitStatus struct {
+	ExitCode   int    `json:"exit_code"`
+	Signal     string `json:"signal,omitempty"`
+	TimedOut   bool   `json:"timed_out,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// exitStatus reports how cmd finished, given the error from running it
+// under ctx with the given timeout. The returned error is set only when the
+// command could not be run or did not finish on its own.
+func exitStatus(ctx context.Context, cmd *exec.Cmd, runErr error, timeout, elapsed time.Duration) (ExitStatus, error) {
+	status := ExitStatus{ExitCode: -1, DurationMs: elapsed.Milliseconds()}
+	if cmd.ProcessState != nil {
+		status.ExitCode = cmd.ProcessState.ExitCode()
+		status.Signal = exitSignal(cmd.ProcessState)
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		status.TimedOut = true
+		return status, errors.New("command timed out after " + timeout.String())
+	}
+	var exitErr *exec.ExitError
+	if runErr != nil && !errors.As(runErr, &exitErr) {
+		return status, runErr
+	}
+	return status, nil
+}
+
+// headTailBuffer keeps the first and last halves of its limit and counts
+// what falls in between. The tail is a ring, so each write costs only its
+// own length however large the limit.
+type headTailBuffer struct {
+	limit     int
+	head      []byte
+	tail      []byte // ring of the last limit-limit/2 bytes, allocated on first use
+	pos       int    // where the next tail byte goes
+	tailTotal int64  // bytes ever written to the tail
+}
+
+func (b *headTailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.limit/2 - len(b.head); room > 0 {
+		k := min(room, len(p))
+		b.head = append(b.head, p[:k]...)
+		p = p[k:]
+	}
+	if len(p) == 0 {
+		return n, nil
+	}
+
+	keep := b.limit - b.limit/2
+	b.tailTotal += int64(len(p))
+	if keep == 0 {
+		return n, nil
+	}
+	if b.tail == nil {
+		b.tail = make([]byte, keep)
+	}
+	if len(p) > keep {
+		p = p[len(p)-keep:]
+	}
+	k := copy(b.tail[b.pos:], p)
+	copy(b.tail, p[k:])
+	b.pos = (b.pos + len(p)) % keep
+	return n, nil
+}
+
+func (b *headTailBuffer) elided() int64 {
+	return max(b.tailTotal-int64(len(b.tail)), 0)
+}
+
+func (b *headTailBuffer) truncated() bool {
+	return b.elided() > 0
+}
+
+func (b *headTailBuffer) String() string {
+	var tail []byte
+	if b.tailTotal < int64(len(b.tail)) {
+		tail = b.tail[:b.tailTotal]
+	} else {
+		tail = append(b.tail[b.pos:len(b.tail):len(b.tail)], b.tail[:b.pos]...)
+	}
+	if !b.truncated() {
+		return string(b.head) + string(tail)
+	}
+	return fmt.Sprintf("%s\n[... %d bytes elided ...]\n%s", b.head, b.elided(), tail)
+}
+
+// outputFile saves a command's full output. It is written to a temporary
+// file beside path, which holds an empty placeholder until finish moves the
+// output into place. Its quota charge grows with each write, so a long or
+// noisy command cannot write past the limits before it exits. Stdout and
+// stderr are written from separate goroutines, so writes are serialized. A
+// failed write is remembered rather than returned, so the command itself
+// keeps running.
+type outputFile struct {
+	mu     sync.Mutex
+	path   string
+	tmp    *os.File
+	size   int64
+	charge *quota.Charge
+	err    error
+}
+
+// createOutputFile reserves path, which must be inside the allowed root and
+// must not exist yet
+func createOutputFile(path string) (*outputFile, error) {
+	validPath, err := pathutil.ValidateWritePath(path)
+	if err != nil {
+		return nil, fmt.Errorf("access denied: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(validPath), 0755); err != nil {
+		return nil, err
+	}
+	placeholder, err := os.OpenFile(validPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil, errors.New("save_output file already exists: " + path)
+		}
+		return nil, err
+	}
+	placeholder.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(validPath), ".output-*")
+	if err != nil {
+		os.Remove(validPath)
+		return nil, err
+	}
+	return &outputFile{path: validPath, tmp: tmp}, nil
+}
+
+func (o *outputFile) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.err != nil {
+		return len(p), nil
+	}
+
+	// Swap the reservation for one covering the larger file
+	o.charge.Release()
+	o.charge, o.err = quota.Check(quota.Change{Path: o.path, Size: o.size + int64(len(p))})
+	if o.err != nil {
+		return len(p), nil
+	}
+
+	n, err := o.tmp.Write(p)
+	o.size += int64(n)
+	o.err = err
+	return len(p), nil
+}
+
+// finish moves the output into place and commits its charge. If it could
+// not be written in full or went over quota nothing is kept.
+func (o *outputFile) finish() (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	defer o.charge.Release()
+
+	err := o.tmp.Close()
+	if o.err != nil {
+		err = o.err
+	}
+	if err == nil {
+		err = os.Rename(o.tmp.Name(), o.path)
+	}
+	if err != nil {
+		os.Remove(o.tmp.Name())
+		os.Remove(o.path)
+		return "", fmt.Errorf("output not saved: %w", err)
+	}
+	o.charge.Commit()
+	return o.path, nil
+}
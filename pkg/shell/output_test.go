@@ -0,0 +1,136 @@
+package shell
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phillip-england/engl/pkg/pathutil"
+	"github.com/phillip-england/engl/pkg/quota"
+)
+
+func TestHeadTailBuffer(t *testing.T) {
+	tests := []struct {
+		name      string
+		writes    []string
+		want      string
+		truncated bool
+	}{
+		{name: "under limit", writes: []string{"ab", "cd"}, want: "abcd"},
+		{name: "exactly limit", writes: []string{"abcdef"}, want: "abcdef"},
+		{name: "over limit in one write", writes: []string{"abcdefghij"}, want: "abc\n[... 4 bytes elided ...]\nhij", truncated: true},
+		{name: "over limit across writes", writes: []string{"ab", "cdefg", "h", "ijk"}, want: "abc\n[... 5 bytes elided ...]\nijk", truncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &headTailBuffer{limit: 6}
+			for _, s := range tt.writes {
+				if n, err := b.Write([]byte(s)); n != len(s) || err != nil {
+					t.Fatalf("Write returned %d, %v", n, err)
+				}
+			}
+			if b.String() != tt.want || b.truncated() != tt.truncated {
+				t.Errorf("got %q truncated %v, want %q truncated %v", b.String(), b.truncated(), tt.want, tt.truncated)
+			}
+		})
+	}
+}
+
+func TestHeadTailBufferMatchesNaive(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 2000 {
+		limit := rng.IntN(40)
+		b := &headTailBuffer{limit: limit}
+		var all []byte
+		for range rng.IntN(10) {
+			chunk := make([]byte, rng.IntN(30))
+			for i := range chunk {
+				chunk[i] = byte('a' + rng.IntN(26))
+			}
+			b.Write(chunk)
+			all = append(all, chunk...)
+		}
+
+		want := string(all)
+		if len(all) > limit {
+			h, keep := limit/2, limit-limit/2
+			want = fmt.Sprintf("%s\n[... %d bytes elided ...]\n%s", all[:h], len(all)-limit, all[len(all)-keep:])
+		}
+		if got := b.String(); got != want {
+			t.Fatalf("limit %d, input %q: got %q, want %q", limit, all, got, want)
+		}
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	old := pathutil.GetAllowedRoot()
+	pathutil.SetAllowedRoot(tmpDir)
+	defer pathutil.SetAllowedRoot(old)
+	defer quota.SetLimits(quota.DefaultLimits)
+
+	o, err := createOutputFile("logs/run.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createOutputFile("logs/run.txt"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("got error %v for a reserved path", err)
+	}
+	o.Write([]byte("hello "))
+	o.Write([]byte("world"))
+	path, err := o.finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "hello world" {
+		t.Errorf("got %q", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(tmpDir, "logs")); len(entries) != 1 {
+		t.Errorf("temporary file left behind: %v", entries)
+	}
+
+	if _, err := createOutputFile("/etc/out.txt"); err == nil || !strings.HasPrefix(err.Error(), "access denied") {
+		t.Errorf("got error %v outside the root", err)
+	}
+	if _, err := createOutputFile(".engl/history/out.txt"); err == nil || !strings.Contains(err.Error(), pathutil.ErrStateDir.Error()) {
+		t.Errorf("got error %v inside the state directory", err)
+	}
+
+	// Writes stop at the quota while the command is still running, and
+	// the output is then discarded along with its placeholder
+	quota.SetLimits(quota.Limits{MaxWriteBytes: 4})
+	o, err = createOutputFile("big.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range []string{"ab", "cd", "ef", "gh"} {
+		o.Write([]byte(chunk))
+	}
+	if info, err := os.Stat(o.tmp.Name()); err != nil || info.Size() != 4 {
+		t.Errorf("temporary file grew past the per-write limit: %v, %v", info.Size(), err)
+	}
+	if _, err := o.finish(); err == nil || !strings.Contains(err.Error(), "output not saved: quota exceeded") {
+		t.Errorf("got error %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "big.txt")); !os.IsNotExist(err) {
+		t.Errorf("over-quota output was kept: %v", err)
+	}
+
+	// Running output counts against the session limit as it is written
+	quota.SetLimits(quota.Limits{MaxSessionBytes: 10})
+	o, err = createOutputFile("running.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Write([]byte("12345678"))
+	if _, err := quota.Check(quota.Change{Path: filepath.Join(tmpDir, "other.txt"), Size: 3}); err == nil {
+		t.Error("a concurrent write ignored the bytes held by running output")
+	}
+	if _, err := o.finish(); err != nil {
+		t.Fatal(err)
+	}
+}
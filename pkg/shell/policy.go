@@ -0,0 +1,268 @@
+package shell
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/phillip-england/engl/pkg/pathutil"
+)
+
+// ArgPolicy declares which arguments a command accepts. Flags are matched
+// by their exact spelling ("-L", "--level"); single-dash clusters such as
+// "-la" are split into "-l" and "-a". A "--" argument ends flag parsing.
+//
+// With StrictFlags set, only flags listed in AllowedFlags, ValueFlags or
+// PathFlags are accepted; otherwise any flag not in DeniedFlags is. Values
+// of PathFlags and, with PositionalPaths, positional arguments after the
+// first LeadingValues are validated as paths inside the allowed root.
+// ValuePatterns maps a flag to a regexp its value must match fully;
+// PositionalPattern applies to positional arguments that are not paths.
+type ArgPolicy struct {
+	StrictFlags       bool              `json:"strict_flags,omitempty"`
+	AllowedFlags      []string          `json:"allowed_flags,omitempty"`
+	DeniedFlags       []string          `json:"denied_flags,omitempty"`
+	ValueFlags        []string          `json:"value_flags,omitempty"`
+	PathFlags         []string          `json:"path_flags,omitempty"`
+	ValuePatterns     map[string]string `json:"value_patterns,omitempty"`
+	PositionalPaths   bool              `json:"positional_paths,omitempty"`
+	LeadingValues     int               `json:"leading_values,omitempty"`
+	PositionalPattern string            `json:"positional_pattern,omitempty"`
+	MinPositional     int               `json:"min_positional,omitempty"`
+	MaxPositional     *int              `json:"max_positional,omitempty"`
+
+	patterns map[string]*regexp.Regexp // compiled by compile; "" is positional
+}
+
+// compile checks the policy and compiles its patterns
+func (p *ArgPolicy) compile() error {
+	p.patterns = map[string]*regexp.Regexp{}
+	for flag, pattern := range p.ValuePatterns {
+		if !p.takesValue(flag) {
+			return fmt.Errorf("value pattern for %s, which is not a value or path flag", flag)
+		}
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("value pattern for %s: %w", flag, err)
+		}
+		p.patterns[flag] = re
+	}
+	if p.PositionalPattern != "" {
+		re, err := regexp.Compile("^(?:" + p.PositionalPattern + ")$")
+		if err != nil {
+			return fmt.Errorf("positional pattern: %w", err)
+		}
+		p.patterns[""] = re
+	}
+	if p.MaxPositional != nil && *p.MaxPositional < p.MinPositional {
+		return fmt.Errorf("max_positional %d is less than min_positional %d", *p.MaxPositional, p.MinPositional)
+	}
+	for _, flag := range slices.Concat(p.AllowedFlags, p.DeniedFlags, p.ValueFlags, p.PathFlags) {
+		if !strings.HasPrefix(flag, "-") || flag == "-" || flag == "--" {
+			return fmt.Errorf("invalid flag %q", flag)
+		}
+	}
+	return nil
+}
+
+func (p *ArgPolicy) takesValue(flag string) bool {
+	return slices.Contains(p.ValueFlags, flag) || slices.Contains(p.PathFlags, flag)
+}
+
+func (p *ArgPolicy) known(flag string) bool {
+	return slices.Contains(p.AllowedFlags, flag) || p.takesValue(flag) || slices.Contains(p.DeniedFlags, flag)
+}
+
+// checkFlag rejects a denied flag, or an unlisted one under StrictFlags
+func (p *ArgPolicy) checkFlag(flag string) error {
+	if slices.Contains(p.DeniedFlags, flag) {
+		return fmt.Errorf("flag %s is denied", flag)
+	}
+	if p.StrictFlags && !slices.Contains(p.AllowedFlags, flag) && !p.takesValue(flag) {
+		return fmt.Errorf("flag %s is not allowed", flag)
+	}
+	return nil
+}
+
+// checkValue matches a flag's value against its pattern and resolves it
+// when the flag takes a path
+func (p *ArgPolicy) checkValue(flag, value, dir string) (string, error) {
+	if re := p.patterns[flag]; re != nil && !re.MatchString(value) {
+		return "", fmt.Errorf("value %q for %s does not match %s", value, flag, p.ValuePatterns[flag])
+	}
+	if !slices.Contains(p.PathFlags, flag) {
+		return value, nil
+	}
+	validPath, err := resolvePath(dir, value)
+	if err != nil {
+		return "", fmt.Errorf("access denied for %s value '%s': %w", flag, value, err)
+	}
+	return validPath, nil
+}
+
+// checkPositional validates the n'th (0-based) positional argument
+func (p *ArgPolicy) checkPositional(n int, arg, dir string) (string, error) {
+	if p.PositionalPaths && n >= p.LeadingValues {
+		validPath, err := resolvePath(dir, arg)
+		if err != nil {
+			return "", fmt.Errorf("access denied for argument '%s': %w", arg, err)
+		}
+		return validPath, nil
+	}
+	if re := p.patterns[""]; re != nil && !re.MatchString(arg) {
+		return "", fmt.Errorf("argument %q does not match %s", arg, p.PositionalPattern)
+	}
+	return arg, nil
+}
+
+// check validates args against the policy and returns them with path
+// values resolved against dir
+func (p *ArgPolicy) check(args []string, dir string) ([]string, error) {
+	out := make([]string, 0, len(args))
+	positional := 0
+	flagsDone := false
+
+	// value returns the value for a flag that takes one: inline if given,
+	// otherwise the next argument
+	value := func(i *int, flag, inline string, hasInline bool) (string, error) {
+		if hasInline {
+			return inline, nil
+		}
+		if *i+1 >= len(args) {
+			return "", fmt.Errorf("flag %s requires a value", flag)
+		}
+		*i++
+		return args[*i], nil
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if flagsDone || arg == "-" || !strings.HasPrefix(arg, "-") {
+			v, err := p.checkPositional(positional, arg, dir)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+			positional++
+			continue
+		}
+
+		if arg == "--" {
+			flagsDone = true
+			out = append(out, arg)
+			continue
+		}
+
+		// Long flags, and single-dash flags spelled out in the policy
+		// (such as find's "-name"), are matched whole
+		if strings.HasPrefix(arg, "--") || len(arg) == 2 || p.known(arg) {
+			flag, inline, hasInline := arg, "", false
+			if k := strings.IndexByte(arg, '='); k > 0 && strings.HasPrefix(arg, "--") {
+				flag, inline, hasInline = arg[:k], arg[k+1:], true
+			}
+			if err := p.checkFlag(flag); err != nil {
+				return nil, err
+			}
+			if !p.takesValue(flag) {
+				if hasInline {
+					return nil, fmt.Errorf("flag %s does not take a value", flag)
+				}
+				out = append(out, arg)
+				continue
+			}
+			wasInline := hasInline
+			v, err := value(&i, flag, inline, hasInline)
+			if err != nil {
+				return nil, err
+			}
+			if v, err = p.checkValue(flag, v, dir); err != nil {
+				return nil, err
+			}
+			if wasInline {
+				out = append(out, flag+"="+v)
+			} else {
+				out = append(out, flag, v)
+			}
+			continue
+		}
+
+		// A cluster of short flags; a value flag takes the rest of the
+		// cluster, or the next argument, as its value
+		for j := 1; j < len(arg); j++ {
+			flag := "-" + arg[j:j+1]
+			if err := p.checkFlag(flag); err != nil {
+				return nil, err
+			}
+			if !p.takesValue(flag) {
+				if j == len(arg)-1 {
+					out = append(out, arg)
+				}
+				continue
+			}
+			rest := arg[j+1:]
+			v, err := value(&i, flag, rest, rest != "")
+			if err != nil {
+				return nil, err
+			}
+			if v, err = p.checkValue(flag, v, dir); err != nil {
+				return nil, err
+			}
+			if rest != "" {
+				out = append(out, arg[:j+1]+v)
+			} else {
+				out = append(out, arg, v)
+			}
+			break
+		}
+	}
+
+	if positional < p.MinPositional {
+		return nil, fmt.Errorf("takes at least %d positional arguments, got %d", p.MinPositional, positional)
+	}
+	if p.MaxPositional != nil && positional > *p.MaxPositional {
+		return nil, fmt.Errorf("takes at most %d positional arguments, got %d", *p.MaxPositional, positional)
+	}
+	return out, nil
+}
+
+// checkArgs validates a call's arguments, resolving relative paths against
+// dir. Commands without a policy fall back to treating anything that looks
+// like a path as one.
+func (c Command) checkArgs(args []string, dir string) ([]string, error) {
+	if c.Args != nil {
+		out, err := c.Args.check(args, dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		return out, nil
+	}
+
+	out := make([]string, len(args))
+	for i, arg := range args {
+		if !pathutil.IsPathArg(arg) {
+			out[i] = arg
+			continue
+		}
+		validPath, err := resolvePath(dir, arg)
+		if err != nil {
+			return nil, fmt.Errorf("access denied for argument '%s': %w", arg, err)
+		}
+		out[i] = validPath
+	}
+	return out, nil
+}
+
+// resolvePath validates path, taking a relative one to be relative to dir
+func resolvePath(dir, path string) (string, error) {
+	if path != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return pathutil.ValidatePath(path)
+}
+
+func intPtr(n int) *int {
+	return &n
+}
@@ -0,0 +1,101 @@
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phillip-england/engl/pkg/pathutil"
+)
+
+func TestArgPolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	old := pathutil.GetAllowedRoot()
+	pathutil.SetAllowedRoot(tmpDir)
+	defer pathutil.SetAllowedRoot(old)
+
+	os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a"), 0644)
+	a := filepath.Join(tmpDir, "a.txt")
+
+	grep := Command{Name: "grep", Args: &ArgPolicy{
+		StrictFlags:     true,
+		AllowedFlags:    []string{"-n", "-i", "-r", "--count"},
+		ValueFlags:      []string{"-m", "--max-count"},
+		PathFlags:       []string{"-f"},
+		ValuePatterns:   map[string]string{"-m": "[0-9]+", "--max-count": "[0-9]+"},
+		PositionalPaths: true,
+		LeadingValues:   1,
+		MinPositional:   1,
+	}}
+	if err := (Config{Commands: []Command{grep}}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cmd     Command
+		args    []string
+		want    []string
+		wantErr string
+	}{
+		{name: "tree depth", cmd: DefaultCommands[0], args: []string{".", "-L", "2"}, want: []string{tmpDir, "-L", "2"}},
+		{name: "tree attached value", cmd: DefaultCommands[0], args: []string{"-aL2"}, want: []string{"-aL2"}},
+		{name: "tree output file", cmd: DefaultCommands[0], args: []string{"-o", "out.txt"}, wantErr: "tree: flag -o is denied"},
+		{name: "tree bad depth", cmd: DefaultCommands[0], args: []string{"-L", "deep"}, wantErr: `tree: value "deep" for -L does not match [0-9]+`},
+		{name: "tree missing value", cmd: DefaultCommands[0], args: []string{"-L"}, wantErr: "tree: flag -L requires a value"},
+		{name: "ls cluster", cmd: DefaultCommands[2], args: []string{"-la", "a.txt"}, want: []string{"-la", a}},
+		{name: "ls unknown in cluster", cmd: DefaultCommands[2], args: []string{"-lZ"}, wantErr: "ls: flag -Z is not allowed"},
+		{name: "ls outside root", cmd: DefaultCommands[2], args: []string{"/etc"}, wantErr: "ls: access denied for argument '/etc'"},
+		{name: "cat needs a file", cmd: DefaultCommands[1], args: []string{"-n"}, wantErr: "cat: takes at least 1 positional arguments, got 0"},
+		{name: "pwd takes no args", cmd: DefaultCommands[3], args: []string{"x"}, wantErr: "pwd: takes at most 0 positional arguments, got 1"},
+		{name: "grep pattern then paths", cmd: grep, args: []string{"-n", "TODO", "a.txt"}, want: []string{"-n", "TODO", a}},
+		{name: "grep long value", cmd: grep, args: []string{"--max-count=3", "x", "."}, want: []string{"--max-count=3", "x", tmpDir}},
+		{name: "grep long bad value", cmd: grep, args: []string{"--max-count=lots", "x"}, wantErr: `grep: value "lots" for --max-count does not match`},
+		{name: "grep path flag", cmd: grep, args: []string{"-f", "a.txt", "x"}, want: []string{"-f", a, "x"}},
+		{name: "grep path flag outside root", cmd: grep, args: []string{"-f", "/etc/passwd", "."}, wantErr: "grep: access denied for -f value '/etc/passwd'"},
+		{name: "grep boolean with value", cmd: grep, args: []string{"--count=1", "x"}, wantErr: "grep: flag --count does not take a value"},
+		{name: "double dash ends flags", cmd: grep, args: []string{"--", "-n", "a.txt"}, want: []string{"--", "-n", a}},
+		{name: "no policy uses path heuristic", cmd: Command{Name: "echo"}, args: []string{"-n", "./a.txt"}, want: []string{"-n", a}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cmd.checkArgs(tt.args, tmpDir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Errorf("got error %v, want prefix %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got args %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArgPolicyCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  ArgPolicy
+		wantErr string
+	}{
+		{name: "pattern on boolean flag", policy: ArgPolicy{AllowedFlags: []string{"-n"}, ValuePatterns: map[string]string{"-n": "x"}}, wantErr: "not a value or path flag"},
+		{name: "bad regexp", policy: ArgPolicy{ValueFlags: []string{"-m"}, ValuePatterns: map[string]string{"-m": "("}}, wantErr: "value pattern for -m"},
+		{name: "bad flag", policy: ArgPolicy{AllowedFlags: []string{"n"}}, wantErr: `invalid flag "n"`},
+		{name: "bad bounds", policy: ArgPolicy{MinPositional: 2, MaxPositional: intPtr(1)}, wantErr: "max_positional 1 is less than min_positional 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.compile()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package shell
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// OutputEvent is sent as an "output" event for each chunk a command writes
+type OutputEvent struct {
+	Stream string `json:"stream"` // "stdout" or "stderr"
+	Data   string `json:"data"`
+}
+
+// ExitEvent is the final "exit" event of a stream. Truncated is set when
+// output over the command's limit was not sent; ElidedBytes counts it.
+type ExitEvent struct {
+	ExitStatus
+	Truncated   bool   `json:"truncated,omitempty"`
+	ElidedBytes int64  `json:"elided_bytes,omitempty"`
+	OutputFile  string `json:"output_file,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// eventStream writes server-sent events, flushing each one. Stdout and
+// stderr are copied on separate goroutines, so writes are serialized.
+type eventStream struct {
+	mu sync.Mutex
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (s *eventStream) send(event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// streamWriter turns each write to stdout or stderr into an output event,
+// until limit bytes have been sent; the rest is counted in elided. A
+// character split across two reads is held back until the rest arrives, so
+// events always carry valid UTF-8 for valid output.
+type streamWriter struct {
+	events  *eventStream
+	stream  string
+	limit   int
+	sent    int
+	elided  int64
+	partial []byte // start of a character cut off by the last write
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	if sw.sent >= sw.limit {
+		sw.elided += int64(len(p))
+		return len(p), nil
+	}
+
+	data := p
+	if len(sw.partial) > 0 {
+		data = append(sw.partial, p...)
+		sw.partial = nil
+	}
+
+	i := len(data) - 1
+	for i > 0 && len(data)-i < utf8.UTFMax && !utf8.RuneStart(data[i]) {
+		i--
+	}
+	if i >= 0 && !utf8.FullRune(data[i:]) {
+		sw.partial = slices.Clone(data[i:])
+		data = data[:i]
+	}
+
+	// Stop at the limit, on a character boundary
+	if room := sw.limit - sw.sent; len(data) > room {
+		cut := room
+		for cut > 0 && !utf8.RuneStart(data[cut]) {
+			cut--
+		}
+		sw.elided += int64(len(data) - cut + len(sw.partial))
+		data, sw.partial = data[:cut], nil
+		sw.sent = sw.limit
+	}
+
+	if len(data) > 0 {
+		sw.sent += len(data)
+		if err := sw.events.send("output", OutputEvent{Stream: sw.stream, Data: string(data)}); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// flush sends a character left incomplete when the output ended
+func (sw *streamWriter) flush() {
+	if len(sw.partial) == 0 {
+		return
+	}
+	if sw.sent+len(sw.partial) > sw.limit {
+		sw.elided += int64(len(sw.partial))
+	} else {
+		sw.events.send("output", OutputEvent{Stream: sw.stream, Data: string(sw.partial)})
+	}
+	sw.partial = nil
+}
+
+// StreamHandler runs an allowed shell command like ExecHandler but sends
+// its output as server-sent events while it runs, ending with an exit event.
+// Each stream sends up to the command's output limit; the rest is dropped.
+func StreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ExecRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeExecError(w, "Invalid JSON body")
+		return
+	}
+	defer r.Body.Close()
+
+	plan, err := prepare(req)
+	if err != nil {
+		writeExecError(w, err.Error())
+		return
+	}
+
+	log.Printf("HIT: %s | Command: %s %v | Dir: %s | Timeout: %s", r.URL.Path, req.Command, plan.args, plan.dir, plan.timeout)
+
+	ctx, cancel := context.WithTimeout(r.Context(), plan.timeout)
+	defer cancel()
+
+	var saved *outputFile
+	if req.SaveOutput != "" {
+		if saved, err = createOutputFile(req.SaveOutput); err != nil {
+			writeExecError(w, err.Error())
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	events := &eventStream{w: w, rc: http.NewResponseController(w)}
+
+	stdout := &streamWriter{events: events, stream: "stdout", limit: plan.command.outputLimit()}
+	stderr := &streamWriter{events: events, stream: "stderr", limit: plan.command.outputLimit()}
+	cmd := plan.cmd(ctx)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if saved != nil {
+		cmd.Stdout, cmd.Stderr = io.MultiWriter(saved, stdout), io.MultiWriter(saved, stderr)
+	}
+
+	start := time.Now()
+	err = cmd.Run()
+	elapsed := time.Since(start)
+	stdout.flush()
+	stderr.flush()
+
+	var outputFile string
+	var saveErr error
+	if saved != nil {
+		outputFile, saveErr = saved.finish()
+	}
+
+	if r.Context().Err() != nil {
+		log.Printf("Client disconnected, killed: %s", req.Command)
+		return
+	}
+
+	status, err := exitStatus(ctx, cmd, err, plan.timeout, elapsed)
+	exit := ExitEvent{
+		ExitStatus:  status,
+		Truncated:   stdout.elided > 0 || stderr.elided > 0,
+		ElidedBytes: stdout.elided + stderr.elided,
+		OutputFile:  outputFile,
+	}
+	if err = errors.Join(err, saveErr); err != nil {
+		exit.Error = err.Error()
+	}
+	events.send("exit", exit)
+}
@@ -0,0 +1,181 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/phillip-england/engl/pkg/pathutil"
+)
+
+type sseEvent struct {
+	name string
+	data string
+}
+
+func readEvents(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var ev sseEvent
+	sc := bufio.NewScanner(strings.NewReader(body))
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			ev.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = strings.TrimPrefix(line, "data: ")
+		case line == "":
+			events = append(events, ev)
+			ev = sseEvent{}
+		}
+	}
+	return events
+}
+
+func TestStreamHandler(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	old := pathutil.GetAllowedRoot()
+	pathutil.SetAllowedRoot(t.TempDir())
+	defer pathutil.SetAllowedRoot(old)
+	defer withCommands(t, Command{Name: "sh", Timeout: "200ms", MaxOutput: "10", Args: &ArgPolicy{}})()
+
+	tests := []struct {
+		name       string
+		body       ExecRequest
+		wantStatus int
+		wantStdout string
+		wantStderr string
+		wantExit   ExitEvent
+	}{
+		{
+			name:       "output and exit status",
+			body:       ExecRequest{Command: "sh", Args: []string{"-c", "echo out; echo err >&2; exit 3"}},
+			wantStatus: http.StatusOK,
+			wantStdout: "out\n",
+			wantStderr: "err\n",
+			wantExit:   ExitEvent{ExitStatus: ExitStatus{ExitCode: 3}},
+		},
+		{
+			name:       "timeout",
+			body:       ExecRequest{Command: "sh", Args: []string{"-c", "echo started; sleep 10"}},
+			wantStatus: http.StatusOK,
+			wantStdout: "started\n",
+			wantExit:   ExitEvent{ExitStatus: ExitStatus{ExitCode: -1, Signal: "killed", TimedOut: true}, Error: "command timed out after 200ms"},
+		},
+		{
+			name:       "output over the limit",
+			body:       ExecRequest{Command: "sh", Args: []string{"-c", "printf 0123456789abcdef; echo err >&2"}},
+			wantStatus: http.StatusOK,
+			wantStdout: "0123456789",
+			wantStderr: "err\n",
+			wantExit:   ExitEvent{Truncated: true, ElidedBytes: 6},
+		},
+		{
+			name:       "not allowed",
+			body:       ExecRequest{Command: "rm"},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.body)
+			rec := httptest.NewRecorder()
+			StreamHandler(rec, httptest.NewRequest(http.MethodPost, "/mcp/tool/shell/exec_stream", bytes.NewReader(body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+				t.Errorf("got content type %q", ct)
+			}
+
+			events := readEvents(t, rec.Body.String())
+			var stdout, stderr strings.Builder
+			for _, ev := range events[:len(events)-1] {
+				var out OutputEvent
+				if ev.name != "output" || json.Unmarshal([]byte(ev.data), &out) != nil {
+					t.Fatalf("unexpected event %+v", ev)
+				}
+				if out.Stream == "stdout" {
+					stdout.WriteString(out.Data)
+				} else {
+					stderr.WriteString(out.Data)
+				}
+			}
+			if stdout.String() != tt.wantStdout || stderr.String() != tt.wantStderr {
+				t.Errorf("got stdout %q stderr %q", stdout.String(), stderr.String())
+			}
+
+			last := events[len(events)-1]
+			var exit ExitEvent
+			if last.name != "exit" || json.Unmarshal([]byte(last.data), &exit) != nil {
+				t.Fatalf("last event is %+v, want exit", last)
+			}
+			exit.DurationMs = 0
+			if exit != tt.wantExit {
+				t.Errorf("got exit %+v, want %+v", exit, tt.wantExit)
+			}
+		})
+	}
+}
+
+func TestStreamWriterSplitRunes(t *testing.T) {
+	tests := []struct {
+		name       string
+		limit      int
+		writes     []string
+		want       []string
+		wantElided int64
+	}{
+		{name: "ascii", writes: []string{"ab", "cd"}, want: []string{"ab", "cd"}},
+		{name: "two byte split", writes: []string{"caf\xc3", "\xa9!"}, want: []string{"caf", "é!"}},
+		{name: "four byte split thrice", writes: []string{"\xf0", "\x9f\x98", "\x80 ok"}, want: []string{"😀 ok"}},
+		{name: "invalid bytes pass through", writes: []string{"a\xff", "b"}, want: []string{"a�", "b"}},
+		{name: "incomplete at end is flushed", writes: []string{"x\xe2\x82"}, want: []string{"x", "��"}},
+		{name: "limit across writes", limit: 3, writes: []string{"ab", "cd", "ef"}, want: []string{"ab", "c"}, wantElided: 3},
+		{name: "limit on a character boundary", limit: 4, writes: []string{"abcé", "zz"}, want: []string{"abc"}, wantElided: 4},
+		{name: "held character past the limit", limit: 2, writes: []string{"ab\xc3"}, want: []string{"ab"}, wantElided: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			limit := tt.limit
+			if limit == 0 {
+				limit = DefaultMaxOutput
+			}
+			sw := &streamWriter{events: &eventStream{w: rec, rc: http.NewResponseController(rec)}, stream: "stdout", limit: limit}
+			for _, s := range tt.writes {
+				if n, err := sw.Write([]byte(s)); n != len(s) || err != nil {
+					t.Fatalf("Write returned %d, %v", n, err)
+				}
+			}
+			sw.flush()
+
+			var got []string
+			for _, ev := range readEvents(t, rec.Body.String()) {
+				var out OutputEvent
+				json.Unmarshal([]byte(ev.data), &out)
+				got = append(got, out.Data)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if sw.elided != tt.wantElided {
+				t.Errorf("got %d elided bytes, want %d", sw.elided, tt.wantElided)
+			}
+		})
+	}
+}
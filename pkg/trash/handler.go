@@ -0,0 +1,176 @@
+package trash
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/phillip-england/engl/pkg/fileutil"
+	"github.com/phillip-england/engl/pkg/pathutil"
+)
+
+type ListResponse struct {
+	Items []Item `json:"items"`
+	Error string `json:"error,omitempty"`
+}
+
+// RestoreRequest restores item ID to its original path, or to Destination
+// when set
+type RestoreRequest struct {
+	ID          string `json:"id"`
+	Destination string `json:"destination,omitempty"`
+}
+
+type RestoreResponse struct {
+	Success bool   `json:"success"`
+	Path    string `json:"path,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// PurgeRequest selects what to remove for good: one item by ID, items older
+// than a duration such as "24h", or everything with All
+type PurgeRequest struct {
+	ID        string `json:"id,omitempty"`
+	OlderThan string `json:"older_than,omitempty"`
+	All       bool   `json:"all,omitempty"`
+}
+
+type PurgeResponse struct {
+	Success bool   `json:"success"`
+	Purged  []Item `json:"purged,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ListHandler lists the items in the trash, newest first
+func ListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	log.Printf("HIT: %s", r.URL.Path)
+
+	items, err := List()
+	if err != nil {
+		writeListError(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListResponse{Items: items})
+}
+
+// RestoreHandler moves an item out of the trash. It refuses to overwrite an
+// existing file.
+func RestoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RestoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeRestoreError(w, "Invalid JSON body")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.ID == "" {
+		writeRestoreError(w, "id is required")
+		return
+	}
+
+	var dest string
+	if req.Destination != "" {
+		validPath, err := pathutil.ValidateWritePath(req.Destination)
+		if err != nil {
+			writeRestoreError(w, "access denied: "+err.Error())
+			return
+		}
+		dest = validPath
+	} else {
+		item, err := Lookup(req.ID)
+		if err != nil {
+			writeRestoreError(w, err.Error())
+			return
+		}
+		if dest, err = item.Target(); err != nil {
+			writeRestoreError(w, "access denied: "+err.Error())
+			return
+		}
+	}
+
+	log.Printf("HIT: %s | ID: %s", r.URL.Path, req.ID)
+
+	unlock := fileutil.LockPath(dest)
+	defer unlock()
+
+	if _, err := Restore(req.ID, dest); err != nil {
+		writeRestoreError(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RestoreResponse{Success: true, Path: dest})
+}
+
+// PurgeHandler permanently removes items from the trash
+func PurgeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PurgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writePurgeError(w, "Invalid JSON body")
+		return
+	}
+	defer r.Body.Close()
+
+	var cutoff time.Time
+	switch {
+	case req.ID != "":
+	case req.OlderThan != "":
+		d, err := time.ParseDuration(req.OlderThan)
+		if err != nil || d <= 0 {
+			writePurgeError(w, "invalid older_than: "+req.OlderThan)
+			return
+		}
+		cutoff = time.Now().Add(-d)
+	case req.All:
+	default:
+		writePurgeError(w, "id, older_than or all is required")
+		return
+	}
+
+	log.Printf("HIT: %s | ID: %s | OlderThan: %s | All: %v", r.URL.Path, req.ID, req.OlderThan, req.All)
+
+	purged, err := Purge(req.ID, cutoff)
+	if err != nil {
+		writePurgeError(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PurgeResponse{Success: true, Purged: purged})
+}
+
+func writeListError(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(ListResponse{Error: msg})
+}
+
+func writeRestoreError(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(RestoreResponse{Error: msg})
+}
+
+func writePurgeError(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(PurgeResponse{Error: msg})
+}
@@ -0,0 +1,122 @@
+package trash
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHandlers(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	path := filepath.Join(tmpDir, "a.txt")
+	os.WriteFile(path, []byte("a"), 0644)
+	item, err := Move(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(handler http.HandlerFunc, body any, resp any) int {
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(body)
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/", &buf))
+		json.NewDecoder(rec.Body).Decode(resp)
+		return rec.Code
+	}
+
+	var list ListResponse
+	rec := httptest.NewRecorder()
+	ListHandler(rec, httptest.NewRequest(http.MethodGet, "/mcp/tool/trash/list", nil))
+	json.NewDecoder(rec.Body).Decode(&list)
+	if rec.Code != http.StatusOK || len(list.Items) != 1 {
+		t.Fatalf("list: status %d, items %+v", rec.Code, list.Items)
+	}
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		body       any
+		wantStatus int
+		wantErr    string
+	}{
+		{name: "restore missing id", handler: RestoreHandler, body: RestoreRequest{}, wantStatus: http.StatusBadRequest, wantErr: "id is required"},
+		{name: "restore outside root", handler: RestoreHandler, body: RestoreRequest{ID: item.ID, Destination: "/etc/a.txt"}, wantStatus: http.StatusBadRequest},
+		{name: "restore to destination", handler: RestoreHandler, body: RestoreRequest{ID: item.ID, Destination: "restored/a.txt"}, wantStatus: http.StatusOK},
+		{name: "restore unknown id", handler: RestoreHandler, body: RestoreRequest{ID: item.ID}, wantStatus: http.StatusBadRequest, wantErr: ErrNotFound.Error()},
+		{name: "purge nothing selected", handler: PurgeHandler, body: PurgeRequest{}, wantStatus: http.StatusBadRequest, wantErr: "id, older_than or all is required"},
+		{name: "purge bad duration", handler: PurgeHandler, body: PurgeRequest{OlderThan: "soon"}, wantStatus: http.StatusBadRequest, wantErr: "invalid older_than: soon"},
+		{name: "purge all", handler: PurgeHandler, body: PurgeRequest{All: true}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp struct {
+				Error string `json:"error"`
+			}
+			code := post(tt.handler, tt.body, &resp)
+			if code != tt.wantStatus {
+				t.Errorf("got status %d, want %d (error %q)", code, tt.wantStatus, resp.Error)
+			}
+			if tt.wantErr != "" && resp.Error != tt.wantErr {
+				t.Errorf("got error %q, want %q", resp.Error, tt.wantErr)
+			}
+		})
+	}
+
+	if content, _ := os.ReadFile(filepath.Join(tmpDir, "restored", "a.txt")); string(content) != "a" {
+		t.Errorf("got restored content %q, want %q", content, "a")
+	}
+}
+
+func TestRestoreTamperedOriginalPath(t *testing.T) {
+	parent := t.TempDir()
+	tmpDir := filepath.Join(parent, "root")
+	os.Mkdir(tmpDir, 0755)
+	defer withAllowedRoot(t, tmpDir)()
+
+	tests := []struct {
+		name     string
+		original string
+		escape   string
+	}{
+		{name: "parent traversal", original: "../pwned.txt", escape: filepath.Join(parent, "pwned.txt")},
+		{name: "nested traversal", original: "a/../../pwned.txt", escape: filepath.Join(parent, "pwned.txt")},
+		{name: "absolute", original: filepath.ToSlash(filepath.Join(parent, "pwned.txt")), escape: filepath.Join(parent, "pwned.txt")},
+		{name: "state directory", original: ".engl/history/forged", escape: filepath.Join(tmpDir, ".engl", "history", "forged")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, "a.txt")
+			os.WriteFile(path, []byte("a"), 0644)
+			item, err := Move(path, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			item.OriginalPath = tt.original
+			if err := writeMeta(item); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			json.NewEncoder(&buf).Encode(RestoreRequest{ID: item.ID})
+			rec := httptest.NewRecorder()
+			RestoreHandler(rec, httptest.NewRequest(http.MethodPost, "/", &buf))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("got status %d: %s", rec.Code, rec.Body)
+			}
+			if _, err := Restore(item.ID, ""); err == nil {
+				t.Error("Restore accepted a tampered original path")
+			}
+			if _, err := os.Stat(tt.escape); !os.IsNotExist(err) {
+				t.Errorf("restored to %s: %v", tt.escape, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package trash
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/phillip-england/engl/pkg/fileutil"
+	"github.com/phillip-england/engl/pkg/pathutil"
+	"github.com/phillip-england/engl/pkg/quota"
+)
+
+// DefaultRetention is how long trashed items are kept before being purged
+const DefaultRetention = 7 * 24 * time.Hour
+
+var (
+	ErrNotFound      = errors.New("trash item not found")
+	ErrTargetExists  = errors.New("restore target already exists")
+	ErrStateDirPath  = pathutil.ErrStateDir
+	errInvalidItemID = errors.New("invalid trash item id")
+)
+
+var (
+	hardDelete bool
+	retention  = DefaultRetention
+	mu         sync.Mutex
+)
+
+// Deletes go to the trash unless ENGL_HARD_DELETE is set. ENGL_TRASH_RETENTION
+// takes a duration such as "72h"; "0" keeps items until purged by hand.
+func init() {
+	hardDelete = os.Getenv("ENGL_HARD_DELETE") != ""
+	if v := os.Getenv("ENGL_TRASH_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			panic(fmt.Sprintf("ENGL_TRASH_RETENTION: invalid duration %q, want one such as \"168h\"", v))
+		}
+		retention = d
+	}
+}
+
+// HardDelete reports whether deletes bypass the trash
+func HardDelete() bool {
+	return hardDelete
+}
+
+// SetHardDelete sets whether deletes bypass the trash (for testing)
+func SetHardDelete(enabled bool) {
+	hardDelete = enabled
+}
+
+// SetRetention sets how long items are kept; zero disables expiry (for testing)
+func SetRetention(d time.Duration) {
+	retention = d
+}
+
+// Item describes one deleted file or directory held in the trash
+type Item struct {
+	ID           string    `json:"id"`
+	OriginalPath string    `json:"original_path"`
+	DeletedAt    time.Time `json:"deleted_at"`
+	Caller       string    `json:"caller,omitempty"`
+	IsDir        bool      `json:"is_dir"`
+	Size         int64     `json:"size"`
+}
+
+// trashDir holds one directory per item, containing the moved data and its
+// metadata
+func trashDir() string {
+	return filepath.Join(pathutil.StateDir(), "trash")
+}
+
+func itemDir(id string) string {
+	return filepath.Join(trashDir(), id)
+}
+
+func dataPath(id string) string {
+	return filepath.Join(itemDir(id), "data")
+}
+
+func metaPath(id string) string {
+	return filepath.Join(itemDir(id), "meta.json")
+}
+
+func newID(now time.Time) string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%s", now.UTC().Format("20060102T150405Z"), hex.EncodeToString(b))
+}
+
+// Move moves path into the trash and returns its record. caller identifies
+// who asked for the delete.
+func Move(path, caller string) (Item, error) {
+	if pathutil.OverlapsStateDir(path) {
+		return Item{}, ErrStateDirPath
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return Item{}, err
+	}
+
+	now := time.Now()
+	item := Item{
+		ID:           newID(now),
+		OriginalPath: relPath(path),
+		DeletedAt:    now.UTC(),
+		Caller:       caller,
+		IsDir:        info.IsDir(),
+		Size:         treeSize(path),
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	pruneLocked(now)
+
+	if err := os.MkdirAll(itemDir(item.ID), 0755); err != nil {
+		return Item{}, err
+	}
+	if err := writeMeta(item); err != nil {
+		os.RemoveAll(itemDir(item.ID))
+		return Item{}, err
+	}
+	if err := fileutil.Move(path, dataPath(item.ID)); err != nil {
+		os.RemoveAll(itemDir(item.ID))
+		return Item{}, err
+	}
+
+	return item, nil
+}
+
+// List returns every item in the trash, newest first. Expired items are
+// purged first.
+func List() ([]Item, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	pruneLocked(time.Now())
+	return listLocked()
+}
+
+func listLocked() ([]Item, error) {
+	entries, err := os.ReadDir(trashDir())
+	if os.IsNotExist(err) {
+		return []Item{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items := []Item{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		item, err := readMeta(e.Name())
+		if err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+	return items, nil
+}
+
+// Lookup returns the item with the given id
+func Lookup(id string) (Item, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return readMeta(id)
+}
+
+// Target returns the validated absolute path item was deleted from. The
+// recorded path is not trusted: it must still resolve inside the allowed
+// root and outside the state directory.
+func (item Item) Target() (string, error) {
+	original := filepath.FromSlash(item.OriginalPath)
+	if !filepath.IsLocal(original) {
+		return "", fmt.Errorf("%w: %s", pathutil.ErrPathOutsideRoot, item.OriginalPath)
+	}
+	return pathutil.ValidateWritePath(filepath.Join(pathutil.GetAllowedRoot(), original))
+}
+
+// Restore moves an item back to dest, or to its original path when dest is
+// empty. The target must not exist; missing parent directories are created.
+func Restore(id, dest string) (Item, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	item, err := readMeta(id)
+	if err != nil {
+		return Item{}, err
+	}
+
+	if dest == "" {
+		if dest, err = item.Target(); err != nil {
+			return Item{}, err
+		}
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		return Item{}, ErrTargetExists
+	}
+
+	// With the state directory inside the root the item is already counted
+	// toward root usage, so moving it back costs nothing
+	var charge *quota.Charge
+	if !pathutil.OverlapsStateDir(pathutil.GetAllowedRoot()) {
+		if charge, err = quota.Check(quota.Change{Path: dest, Size: item.Size}); err != nil {
+			return Item{}, err
+		}
+		defer charge.Release()
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return Item{}, err
+	}
+	if err := fileutil.Move(dataPath(id), dest); err != nil {
+		return Item{}, err
+	}
+	charge.Commit()
+
+	os.RemoveAll(itemDir(id))
+	return item, nil
+}
+
+// Purge permanently removes items. With an id only that item is removed;
+// otherwise every item deleted before cutoff is removed (a zero cutoff
+// removes everything).
+func Purge(id string, cutoff time.Time) ([]Item, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if id != "" {
+		item, err := readMeta(id)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.RemoveAll(itemDir(id)); err != nil {
+			return nil, err
+		}
+		quota.Invalidate()
+		return []Item{item}, nil
+	}
+
+	return purgeBeforeLocked(cutoff)
+}
+
+func purgeBeforeLocked(cutoff time.Time) ([]Item, error) {
+	items, err := listLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	purged := []Item{}
+	defer quota.Invalidate()
+	for _, item := range items {
+		if !cutoff.IsZero() && !item.DeletedAt.Before(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(itemDir(item.ID)); err != nil {
+			return purged, err
+		}
+		purged = append(purged, item)
+	}
+	return purged, nil
+}
+
+// pruneLocked applies the retention policy. Failures are ignored since
+// expiry is housekeeping and must not block deletes or listing.
+func pruneLocked(now time.Time) {
+	if retention <= 0 {
+		return
+	}
+	purgeBeforeLocked(now.Add(-retention))
+}
+
+func writeMeta(item Item) error {
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteFile(metaPath(item.ID), data, 0644)
+}
+
+func readMeta(id string) (Item, error) {
+	if id == "" || !filepath.IsLocal(id) || filepath.Base(id) != id {
+		return Item{}, errInvalidItemID
+	}
+	data, err := os.ReadFile(metaPath(id))
+	if os.IsNotExist(err) {
+		return Item{}, ErrNotFound
+	}
+	if err != nil {
+		return Item{}, err
+	}
+	var item Item
+	if err := json.Unmarshal(data, &item); err != nil {
+		return Item{}, err
+	}
+	return item, nil
+}
+
+func relPath(path string) string {
+	rel, err := filepath.Rel(pathutil.GetAllowedRoot(), path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// treeSize returns the total size of the regular files under path
+func treeSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,169 @@
+package trash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/phillip-england/engl/pkg/pathutil"
+	"github.com/phillip-england/engl/pkg/quota"
+)
+
+func withAllowedRoot(t *testing.T, root string) func() {
+	old := pathutil.GetAllowedRoot()
+	pathutil.SetAllowedRoot(root)
+	return func() {
+		pathutil.SetAllowedRoot(old)
+	}
+}
+
+func TestMoveAndRestore(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	dir := filepath.Join(tmpDir, "pkg")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "a.go"), []byte("package pkg\n"), 0644)
+
+	item, err := Move(dir, "127.0.0.1:1234")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item.OriginalPath != "pkg" || !item.IsDir || item.Size != 12 || item.Caller != "127.0.0.1:1234" {
+		t.Errorf("got item %+v", item)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("directory should have been moved out")
+	}
+
+	items, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].ID != item.ID {
+		t.Fatalf("got items %+v, want one with id %s", items, item.ID)
+	}
+
+	// Restoring onto something that has taken the path's place is refused
+	os.WriteFile(dir, []byte("squatter"), 0644)
+	if _, err := Restore(item.ID, ""); err != ErrTargetExists {
+		t.Errorf("got %v, want ErrTargetExists", err)
+	}
+	os.Remove(dir)
+
+	if _, err := Restore(item.ID, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "a.go")); string(content) != "package pkg\n" {
+		t.Errorf("got content %q after restore", content)
+	}
+	if items, _ := List(); len(items) != 0 {
+		t.Errorf("got %d items after restore, want 0", len(items))
+	}
+	if _, err := Restore(item.ID, ""); err != ErrNotFound {
+		t.Errorf("restore twice: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestRestoreAtRootLimit(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+	defer quota.SetLimits(quota.DefaultLimits)
+
+	path := filepath.Join(tmpDir, "big.txt")
+	os.WriteFile(path, make([]byte, 100), 0644)
+	item, err := Move(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The trashed bytes still count, so nothing new fits
+	quota.SetLimits(quota.Limits{MaxRootBytes: 100})
+	if _, err := quota.Check(quota.Change{Path: filepath.Join(tmpDir, "new.txt"), Size: 1}); !errors.Is(err, quota.ErrQuotaExceeded) {
+		t.Errorf("got %v, want root quota error while the item is in the trash", err)
+	}
+
+	// but restoring them moves space already counted
+	if _, err := Restore(item.ID, ""); err != nil {
+		t.Errorf("restore at the root limit: %v", err)
+	}
+}
+
+func TestMoveRejectsStateDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	os.MkdirAll(pathutil.StateDir(), 0755)
+	for _, path := range []string{tmpDir, pathutil.StateDir()} {
+		if _, err := Move(path, ""); err != ErrStateDirPath {
+			t.Errorf("Move(%s): got %v, want ErrStateDirPath", path, err)
+		}
+	}
+}
+
+func TestPurge(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+
+	trashFile := func(name string) Item {
+		path := filepath.Join(tmpDir, name)
+		os.WriteFile(path, []byte(name), 0644)
+		item, err := Move(path, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return item
+	}
+
+	a, b := trashFile("a.txt"), trashFile("b.txt")
+
+	if _, err := Purge("../../etc", time.Time{}); err != errInvalidItemID {
+		t.Errorf("got %v, want errInvalidItemID", err)
+	}
+
+	purged, err := Purge(a.ID, time.Time{})
+	if err != nil || len(purged) != 1 || purged[0].ID != a.ID {
+		t.Fatalf("purge by id: got %+v, %v", purged, err)
+	}
+
+	// Nothing is older than an hour
+	if purged, _ := Purge("", time.Now().Add(-time.Hour)); len(purged) != 0 {
+		t.Errorf("got %d purged, want 0", len(purged))
+	}
+
+	purged, err = Purge("", time.Time{})
+	if err != nil || len(purged) != 1 || purged[0].ID != b.ID {
+		t.Fatalf("purge all: got %+v, %v", purged, err)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer withAllowedRoot(t, tmpDir)()
+	defer SetRetention(DefaultRetention)
+
+	path := filepath.Join(tmpDir, "old.txt")
+	os.WriteFile(path, []byte("old"), 0644)
+	item, err := Move(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Backdate the item past the retention window
+	item.DeletedAt = time.Now().Add(-2 * time.Hour)
+	if err := writeMeta(item); err != nil {
+		t.Fatal(err)
+	}
+
+	SetRetention(0)
+	if items, _ := List(); len(items) != 1 {
+		t.Fatalf("got %d items with expiry disabled, want 1", len(items))
+	}
+
+	SetRetention(time.Hour)
+	if items, _ := List(); len(items) != 0 {
+		t.Errorf("got %d items after expiry, want 0", len(items))
+	}
+}